@@ -0,0 +1,101 @@
+package yun
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	//principalKey 认证主体在context.Context中保存的键
+	principalKey struct{}
+
+	//BasicValidator 校验Basic认证的用户名与密码
+	BasicValidator func(user, password string, c *Context) bool
+
+	//KeyLookup 根据Bearer令牌或API Key查找认证主体
+	KeyLookup func(key string, c *Context) (principal interface{}, ok bool)
+)
+
+//Principal 获取认证中间件保存的认证主体
+//return 认证主体：BasicAuth为用户名，KeyAuth为KeyLookup的返回值，JWT为JWTClaims；未认证时为nil
+func (c *Context) Principal() interface{} {
+	return c.requestContext().Value(principalKey{})
+}
+
+//SetPrincipal 保存认证主体，供自定义认证中间件使用
+//principal 认证主体
+func (c *Context) SetPrincipal(principal interface{}) {
+	c.WithValue(principalKey{}, principal)
+}
+
+//BasicAuth HTTP Basic认证中间件，认证失败时响应401并发送WWW-Authenticate质询
+//validator 用户名与密码校验函数
+//realm 认证域，为空时为"Restricted"
+//return 中间件
+func BasicAuth(validator BasicValidator, realm ...string) HandlerFunc {
+	challenge := `Basic realm="Restricted", charset="UTF-8"`
+	if len(realm) > 0 {
+		challenge = "Basic realm=" + strconv.Quote(realm[0]) + `, charset="UTF-8"`
+	}
+
+	return func(c *Context) {
+		if user, password, ok := c.Request().BasicAuth(); ok && validator(user, password, c) {
+			c.SetPrincipal(user)
+			c.Next()
+			return
+		}
+
+		unauthorized(c, challenge)
+	}
+}
+
+//KeyAuth Bearer令牌或API Key认证中间件
+//依次从"Authorization: Bearer <key>"与X-API-Key请求头读取，认证失败时响应401
+//lookup 认证主体查找函数
+//return 中间件
+func KeyAuth(lookup KeyLookup) HandlerFunc {
+	return func(c *Context) {
+		key := bearerToken(c.Request())
+		if key == "" {
+			key = c.Request().Header.Get(HeaderXAPIKey)
+		}
+
+		if key == "" {
+			unauthorized(c, `Bearer realm="Restricted"`)
+			return
+		}
+
+		principal, ok := lookup(key, c)
+		if !ok {
+			unauthorized(c, `Bearer error="invalid_token"`)
+			return
+		}
+
+		c.SetPrincipal(principal)
+		c.Next()
+	}
+}
+
+//SecureCompare 以固定时间比较两个字符串，用于校验密码或密钥
+//return 是否相等
+func SecureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+//bearerToken: 获取Authorization请求头中的Bearer令牌
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get(HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+//unauthorized: 发送质询并中止响应
+func unauthorized(c *Context, challenge string) {
+	c.Response().Header().Set(HeaderWWWAuthenticate, challenge)
+	c.String(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+	c.Abort()
+}
@@ -0,0 +1,200 @@
+package yun
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//DefaultDecompressLimit Decompress默认的解压后大小上限
+const DefaultDecompressLimit = "32MB"
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+}
+
+type (
+	//limitedBody 限制读取字节数的请求体，路由的BodyLimit可修改引擎设置的上限
+	limitedBody struct {
+		rc       io.ReadCloser
+		limit    int64
+		read     int64
+		exceeded bool
+		//decompressed 由Decompress创建，上限只能调低
+		decompressed bool
+	}
+
+	//decompressBody 关闭时同时关闭解压器与原始请求体
+	decompressBody struct {
+		r    io.ReadCloser
+		body io.ReadCloser
+	}
+)
+
+//BodyLimit 请求体大小限制中间件，覆盖Engine.MaxBodySize，超出时响应413
+//在Decompress之后使用时只能调低解压后的大小上限
+//limit 大小上限，如"512KB"、"2MB"
+//return 中间件
+func BodyLimit(limit string) HandlerFunc {
+	n, err := ParseSize(limit)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *Context) {
+		req := c.Request()
+		if req.ContentLength > n {
+			c.String(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+			c.Abort()
+			return
+		}
+
+		if req.Body == nil || req.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		lb, ok := req.Body.(*limitedBody)
+		if ok {
+			if !lb.decompressed || n < lb.limit {
+				lb.limit = n
+			}
+			c.Next()
+			return
+		}
+
+		lb = &limitedBody{rc: req.Body, limit: n}
+		req.Body = lb
+		c.Next()
+		lb.respond(c)
+	}
+}
+
+//Decompress 请求体解压中间件，支持gzip、deflate，解压后超出上限时响应413
+//limit 解压后的大小上限，为空时使用DefaultDecompressLimit
+//return 中间件
+func Decompress(limit ...string) HandlerFunc {
+	max := DefaultDecompressLimit
+	if len(limit) > 0 {
+		max = limit[0]
+	}
+	n, err := ParseSize(max)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *Context) {
+		req := c.Request()
+		encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(HeaderContentEncoding)))
+		if encoding == "" || encoding == "identity" || req.Body == nil || req.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		var (
+			r   io.ReadCloser
+			err error
+		)
+		switch encoding {
+		case EncodingGzip, "x-gzip":
+			r, err = gzip.NewReader(req.Body)
+		case EncodingDeflate:
+			r, err = zlib.NewReader(req.Body)
+		default:
+			c.String(http.StatusUnsupportedMediaType, "Unsupported Content-Encoding: "+encoding)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.String(http.StatusBadRequest, "Malformed "+encoding+" request body")
+			c.Abort()
+			return
+		}
+
+		lb := &limitedBody{rc: &decompressBody{r: r, body: req.Body}, limit: n, decompressed: true}
+		req.Body = lb
+		req.ContentLength = -1
+		req.Header.Del(HeaderContentEncoding)
+		req.Header.Del(HeaderContentLength)
+
+		c.Next()
+		lb.respond(c)
+	}
+}
+
+//ParseSize 解析带单位的字节数，单位为B、KB、MB、GB（按1024进位）
+//s 如"2MB"、"512KB"、"1024"
+//return 字节数、错误
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, errors.New("Invalid size: " + s)
+	}
+	f, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || f < 0 {
+		return 0, errors.New("Invalid size: " + s)
+	}
+	return int64(f * float64(unit)), nil
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.limit > 0 {
+		remain := b.limit - b.read
+		if remain < 0 {
+			b.exceeded = true
+			return 0, &http.MaxBytesError{Limit: b.limit}
+		}
+		//多读一个字节以判断是否超出
+		if int64(len(p)) > remain+1 {
+			p = p[:remain+1]
+		}
+	}
+
+	n, err := b.rc.Read(p)
+	b.read += int64(n)
+	if b.limit > 0 && b.read > b.limit {
+		b.exceeded = true
+		return n - int(b.read-b.limit), &http.MaxBytesError{Limit: b.limit}
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+//respond: 处理函数读取超限而未响应时响应413
+func (b *limitedBody) respond(c *Context) {
+	if b.exceeded && !c.Written() {
+		c.String(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+	}
+}
+
+func (b *decompressBody) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *decompressBody) Close() error {
+	b.r.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,616 @@
+package yun
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//cacheTagsKey 处理函数追加的缓存标签在Context中保存的键
+const cacheTagsKey = "cache-tags"
+
+//uncachedHeaders 逐跳及逐请求的响应头，不随缓存项保存
+var uncachedHeaders = map[string]bool{
+	HeaderConnection:         true,
+	"Keep-Alive":             true,
+	"Proxy-Connection":       true,
+	"Transfer-Encoding":      true,
+	HeaderUpgrade:            true,
+	"Trailer":                true,
+	"Date":                   true,
+	HeaderAge:                true,
+	HeaderXCache:             true,
+	HeaderXRequestID:         true,
+	HeaderTraceparent:        true,
+	HeaderTracestate:         true,
+	HeaderRateLimitLimit:     true,
+	HeaderRateLimitRemaining: true,
+	HeaderRateLimitReset:     true,
+	HeaderRetryAfter:         true,
+}
+
+type (
+	//CacheConfig 响应缓存配置
+	CacheConfig struct {
+		//Store 缓存存储，为nil时使用容量为1000条、64MB的内存LRU存储
+		Store CacheStore
+		//TTL 响应未通过Cache-Control指定有效期时的缓存时间
+		TTL time.Duration
+		//StaleWhileRevalidate 过期后仍可返回旧响应并在后台刷新的时间，响应中的stale-while-revalidate优先
+		StaleWhileRevalidate time.Duration
+		//VaryHeaders 参与缓存键的请求头，响应的Vary中有不在此列表的请求头时不缓存
+		//如内层使用Compress时须包含Accept-Encoding
+		VaryHeaders []string
+		//KeyFunc 自定义缓存键，为nil时由方法、路径、排序后的查询参数及VaryHeaders组成
+		KeyFunc func(*Context) string
+		//Tags 响应的缓存标签，用于按标签清除
+		Tags func(*Context) []string
+		//MaxBodySize 超过该字节数的响应不缓存
+		MaxBodySize int
+		//Skipper 返回true时跳过缓存
+		Skipper func(*Context) bool
+	}
+
+	//CacheEntry 缓存的响应
+	CacheEntry struct {
+		Status int
+		Header http.Header
+		Body   []byte
+		Tags   []string
+		//Stored 存入时间
+		Stored time.Time
+		//Expires 过期时间
+		Expires time.Time
+		//StaleUntil 可返回旧响应的截止时间
+		StaleUntil time.Time
+	}
+
+	//CacheStore 响应缓存存储
+	CacheStore interface {
+		Get(key string) (*CacheEntry, bool)
+		Set(key string, entry *CacheEntry)
+		//Delete 按键清除
+		Delete(key string)
+		//DeleteTag 清除带有该标签的全部缓存
+		DeleteTag(tag string)
+	}
+
+	//MemoryCacheStore 容量有限的内存LRU缓存存储
+	MemoryCacheStore struct {
+		lock       sync.Mutex
+		maxEntries int
+		maxBytes   int64
+		bytes      int64
+		ll         *list.List
+		items      map[string]*list.Element
+		tags       map[string]map[string]struct{}
+	}
+
+	cacheItem struct {
+		key   string
+		entry *CacheEntry
+		size  int64
+	}
+
+	//cacheCall 同一缓存键正在进行的请求，并发未命中的请求等待其结果
+	cacheCall struct {
+		done  chan struct{}
+		entry *CacheEntry
+	}
+
+	//cacheWriter 写出响应的同时记录状态、内层handler设置的响应头与响应体
+	cacheWriter struct {
+		ResponseWriter
+		max       int
+		before    http.Header
+		header    http.Header
+		body      bytes.Buffer
+		cacheable bool
+	}
+)
+
+//DefaultCacheConfig 默认的缓存配置
+var DefaultCacheConfig = CacheConfig{
+	TTL:         time.Minute,
+	MaxBodySize: 1 << 20,
+}
+
+//Cache 响应缓存中间件，仅缓存GET请求
+//遵循请求与响应的Cache-Control，并发未命中时只执行一次处理函数，过期后在stale-while-revalidate期间返回旧响应并后台刷新
+//带有Authorization的请求只存储、使用含public、s-maxage或must-revalidate的响应（RFC 9111 3.5节）
+//config 缓存配置，为空时使用DefaultCacheConfig
+//return 中间件
+func Cache(config ...CacheConfig) HandlerFunc {
+	cfg := DefaultCacheConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryCacheStore(1000, 64<<20)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheConfig.TTL
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultCacheConfig.MaxBodySize
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = func(c *Context) string {
+			return cacheKey(c.Request(), cfg.VaryHeaders)
+		}
+	}
+
+	var (
+		lock  sync.Mutex
+		calls = make(map[string]*cacheCall)
+	)
+
+	return func(c *Context) {
+		req := c.Request()
+		if req.Method != GET || cfg.Skipper != nil && cfg.Skipper(c) {
+			c.Next()
+			return
+		}
+
+		directives := parseCacheControl(req.Header.Get(HeaderCacheControl))
+		if _, has := directives["no-store"]; has {
+			c.Next()
+			return
+		}
+		_, noCache := directives["no-cache"]
+		if v, has := directives["max-age"]; has && v == "0" {
+			noCache = true
+		}
+
+		key := cfg.KeyFunc(c)
+		now := time.Now()
+		authorized := req.Header.Get(HeaderAuthorization) != ""
+
+		if entry, ok := cfg.Store.Get(key); ok && !noCache && (!authorized || sharedWithAuthorization(entry.Header)) {
+			if now.Before(entry.Expires) {
+				serveCacheEntry(c, entry, "HIT", now)
+				return
+			}
+			if now.Before(entry.StaleUntil) {
+				lock.Lock()
+				call, running := calls[key]
+				if !running {
+					call = &cacheCall{done: make(chan struct{})}
+					calls[key] = call
+				}
+				lock.Unlock()
+
+				if !running {
+					cfg.revalidate(c, key, authorized, call, func() {
+						lock.Lock()
+						delete(calls, key)
+						lock.Unlock()
+					})
+				}
+				serveCacheEntry(c, entry, "STALE", now)
+				return
+			}
+		}
+
+		//合并并发的未命中请求
+		lock.Lock()
+		if call, running := calls[key]; running {
+			lock.Unlock()
+			select {
+			case <-call.done:
+				if call.entry != nil && (!authorized || sharedWithAuthorization(call.entry.Header)) {
+					serveCacheEntry(c, call.entry, "HIT", time.Now())
+					return
+				}
+			case <-c.Done():
+				//等待其他请求的结果时超时或被取消
+				code := http.StatusGatewayTimeout
+				if c.Err() == context.Canceled {
+					code = http.StatusServiceUnavailable
+				}
+				c.String(code, http.StatusText(code))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+		call := &cacheCall{done: make(chan struct{})}
+		calls[key] = call
+		lock.Unlock()
+
+		defer func() {
+			lock.Lock()
+			delete(calls, key)
+			lock.Unlock()
+			close(call.done)
+		}()
+
+		prev := c.ResponseWriter
+		prev.Header().Set(HeaderXCache, "MISS")
+		cw := &cacheWriter{ResponseWriter: prev, max: cfg.MaxBodySize, before: prev.Header().Clone(), cacheable: true}
+		c.ResponseWriter = cw
+		defer func() {
+			c.ResponseWriter = prev
+		}()
+		c.Next()
+
+		if !cw.cacheable || cw.header == nil {
+			return
+		}
+		if entry := cfg.newEntry(c, authorized, cw.Status(), cw.header, cw.body.Bytes()); entry != nil {
+			cfg.Store.Set(key, entry)
+			call.entry = entry
+		}
+	}
+}
+
+//CacheTags 为当前响应追加缓存标签
+//tags 标签
+func (c *Context) CacheTags(tags ...string) {
+	var all []string
+	if v, ok := c.Get(cacheTagsKey); ok {
+		all, _ = v.([]string)
+	}
+	c.Set(cacheTagsKey, append(all, tags...))
+}
+
+//revalidate: 在后台执行剩余的handler刷新缓存，完成后调用done
+func (cfg *CacheConfig) revalidate(c *Context, key string, authorized bool, call *cacheCall, done func()) {
+	bw := newBufferWriter()
+	cp := c.fork(bw)
+	cp.SetContext(context.WithoutCancel(c.requestContext()))
+	eng := c.engine
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				eng.printError(fmt.Errorf("cache revalidation panic: %v", p))
+			}
+			done()
+			close(call.done)
+		}()
+
+		cp.Next()
+		//未写出响应时保留旧的缓存项
+		if !bw.Written() {
+			return
+		}
+		if entry := cfg.newEntry(cp, authorized, bw.status, bw.header, bw.body.Bytes()); entry != nil {
+			cfg.Store.Set(key, entry)
+			call.entry = entry
+		}
+	}()
+}
+
+//newEntry: 根据响应的Cache-Control创建缓存项，不可缓存时返回nil
+//authorized 请求是否带有Authorization
+func (cfg *CacheConfig) newEntry(c *Context, authorized bool, status int, header http.Header, body []byte) *CacheEntry {
+	switch status {
+	case http.StatusOK, http.StatusNoContent, http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return nil
+	}
+	if len(body) > cfg.MaxBodySize || header.Get(HeaderSetCookie) != "" || !cfg.coversVary(header) {
+		return nil
+	}
+	if authorized && !sharedWithAuthorization(header) {
+		return nil
+	}
+
+	directives := parseCacheControl(header.Get(HeaderCacheControl))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, has := directives[d]; has {
+			return nil
+		}
+	}
+
+	ttl := cfg.TTL
+	if v, has := directives["s-maxage"]; has {
+		ttl = parseSeconds(v)
+	} else if v, has := directives["max-age"]; has {
+		ttl = parseSeconds(v)
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	swr := cfg.StaleWhileRevalidate
+	if v, has := directives["stale-while-revalidate"]; has {
+		swr = parseSeconds(v)
+	}
+
+	var tags []string
+	if cfg.Tags != nil {
+		tags = append(tags, cfg.Tags(c)...)
+	}
+	if v, ok := c.Get(cacheTagsKey); ok {
+		extra, _ := v.([]string)
+		tags = append(tags, extra...)
+	}
+
+	stored := make(http.Header, len(header))
+	for k, v := range header {
+		if !uncachedHeaders[k] && !strings.HasPrefix(k, "Access-Control-") {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+
+	now := time.Now()
+	return &CacheEntry{
+		Status:     status,
+		Header:     stored,
+		Body:       append([]byte(nil), body...),
+		Tags:       tags,
+		Stored:     now,
+		Expires:    now.Add(ttl),
+		StaleUntil: now.Add(ttl + swr),
+	}
+}
+
+//coversVary: 响应的Vary中的请求头是否都已参与缓存键
+func (cfg *CacheConfig) coversVary(header http.Header) bool {
+	for _, v := range header.Values(HeaderVary) {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !slices.ContainsFunc(cfg.VaryHeaders, func(h string) bool {
+				return strings.EqualFold(h, name)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//sharedWithAuthorization: 响应是否允许用于带有Authorization的请求
+func sharedWithAuthorization(header http.Header) bool {
+	directives := parseCacheControl(header.Get(HeaderCacheControl))
+	for _, d := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, has := directives[d]; has {
+			return true
+		}
+	}
+	return false
+}
+
+//serveCacheEntry: 以缓存项响应并中止后续handler
+func serveCacheEntry(c *Context, entry *CacheEntry, state string, now time.Time) {
+	h := c.Response().Header()
+	for k, v := range entry.Header {
+		if k == HeaderVary {
+			for _, name := range v {
+				addVary(h, name)
+			}
+			continue
+		}
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set(HeaderAge, strconv.Itoa(int(now.Sub(entry.Stored)/time.Second)))
+	h.Set(HeaderXCache, state)
+
+	if tag := entry.Header.Get(HeaderETag); tag != "" && matchETag(c.Request().Header.Get(HeaderIfNoneMatch), tag) {
+		h.Del(HeaderContentType)
+		h.Del(HeaderContentLength)
+		c.WriteHeader(http.StatusNotModified)
+	} else {
+		c.WriteHeader(entry.Status)
+		c.Write(entry.Body)
+	}
+	c.Abort()
+}
+
+//cacheKey: 由方法、路径、排序后的查询参数及参与缓存键的请求头组成
+func cacheKey(req *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.Path)
+	if req.URL.RawQuery != "" {
+		b.WriteByte('?')
+		b.WriteString(req.URL.Query().Encode())
+	}
+	for _, name := range vary {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+//headerDiff: 在before基础上新增或修改的响应头，仅追加值时只保留追加的部分
+func headerDiff(before, after http.Header) http.Header {
+	diff := make(http.Header)
+	for k, v := range after {
+		prev := before[k]
+		if len(prev) <= len(v) && slices.Equal(prev, v[:len(prev)]) {
+			if len(prev) < len(v) {
+				diff[k] = append([]string(nil), v[len(prev):]...)
+			}
+			continue
+		}
+		diff[k] = append([]string(nil), v...)
+	}
+	return diff
+}
+
+//parseCacheControl: 解析Cache-Control指令，指令名转为小写
+func parseCacheControl(v string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+//parseSeconds: 解析秒数，无效时为0
+func parseSeconds(v string) time.Duration {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+//NewMemoryCacheStore 创建内存LRU缓存存储
+//maxEntries 最大条目数，为0时不限制
+//maxBytes 响应体的最大总字节数，为0时不限制
+//return 内存存储
+func NewMemoryCacheStore(maxEntries int, maxBytes int64) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+	}
+}
+
+//Get 获取缓存项，超过StaleUntil的缓存项将被移除
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	el, has := s.items[key]
+	if !has {
+		return nil, false
+	}
+	item := el.Value.(*cacheItem)
+	if time.Now().After(item.entry.StaleUntil) {
+		s.remove(el)
+		return nil, false
+	}
+
+	s.ll.MoveToFront(el)
+	return item.entry, true
+}
+
+//Set 保存缓存项，超出容量时淘汰最久未使用的缓存项
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if el, has := s.items[key]; has {
+		s.remove(el)
+	}
+
+	item := &cacheItem{key: key, entry: entry, size: int64(len(key) + len(entry.Body))}
+	if s.maxBytes > 0 && item.size > s.maxBytes {
+		return
+	}
+	s.items[key] = s.ll.PushFront(item)
+	s.bytes += item.size
+	for _, tag := range entry.Tags {
+		keys, has := s.tags[tag]
+		if !has {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	for s.maxEntries > 0 && s.ll.Len() > s.maxEntries || s.maxBytes > 0 && s.bytes > s.maxBytes {
+		s.remove(s.ll.Back())
+	}
+}
+
+//Delete 按键清除
+func (s *MemoryCacheStore) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if el, has := s.items[key]; has {
+		s.remove(el)
+	}
+}
+
+//DeleteTag 清除带有该标签的全部缓存
+func (s *MemoryCacheStore) DeleteTag(tag string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key := range s.tags[tag] {
+		if el, has := s.items[key]; has {
+			s.remove(el)
+		}
+	}
+	delete(s.tags, tag)
+}
+
+//Len 缓存项数量
+func (s *MemoryCacheStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ll.Len()
+}
+
+//remove: 移除缓存项及其标签索引
+func (s *MemoryCacheStore) remove(el *list.Element) {
+	item := s.ll.Remove(el).(*cacheItem)
+	delete(s.items, item.key)
+	s.bytes -= item.size
+
+	for _, tag := range item.entry.Tags {
+		if keys, has := s.tags[tag]; has {
+			delete(keys, item.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.header == nil {
+		w.header = headerDiff(w.before, w.ResponseWriter.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if w.header == nil {
+		w.WriteHeader(w.Status())
+	}
+	if w.cacheable {
+		if w.body.Len()+len(data) > w.max {
+			w.cacheable = false
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(data)
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// 流式响应不缓存
+func (w *cacheWriter) Flush() {
+	w.cacheable = false
+	w.ResponseWriter.Flush()
+}
+
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.cacheable = false
+	return w.ResponseWriter.Hijack()
+}
+
+// 供http.ResponseController获取底层的ResponseWriter
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,208 @@
+package yun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+type (
+	//Client 出站http客户端，Engine.Client为Context.Send使用的实例
+	Client struct {
+		//Transport 底层传输，为nil时使用http.DefaultTransport
+		Transport http.RoundTripper
+		//Timeout 单次请求的超时时间（含读取响应体）
+		Timeout time.Duration
+		//Retries 幂等请求失败后的最大重试次数
+		Retries int
+		//RetryBackoff 首次重试前的等待时间，之后按2倍递增并加入随机抖动
+		RetryBackoff time.Duration
+		//MaxBackoff 重试等待时间的上限
+		MaxBackoff time.Duration
+		//RetryStatus 需要重试的响应状态码
+		RetryStatus []int
+		//MaxResponseSize 响应体的最大字节数
+		MaxResponseSize int64
+		//ForwardHeaders 从入站请求转发到出站请求的请求头
+		ForwardHeaders []string
+	}
+
+	//ClientResponse 出站请求的响应
+	ClientResponse struct {
+		StatusCode int
+		Header     http.Header
+		Body       []byte
+	}
+)
+
+var errResponseTooLarge = errors.New("response body too large")
+
+//NewClient 创建使用默认配置的客户端
+//return 客户端
+func NewClient() *Client {
+	return &Client{
+		Timeout:         30 * time.Second,
+		Retries:         2,
+		RetryBackoff:    100 * time.Millisecond,
+		MaxBackoff:      2 * time.Second,
+		RetryStatus:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		MaxResponseSize: 10 << 20,
+		ForwardHeaders:  []string{HeaderXRequestID, HeaderTraceparent, HeaderTracestate},
+	}
+}
+
+//Do 发送请求并读取完整响应，幂等请求在网络错误或RetryStatus时重试，请求的context结束时立即返回
+//req 请求，有请求体时须可通过GetBody重新获取
+//return 响应、错误
+func (cl *Client) Do(req *http.Request) (*ClientResponse, error) {
+	hc := &http.Client{Transport: cl.Transport, Timeout: cl.Timeout}
+	ctx := req.Context()
+
+	retries := cl.Retries
+	if !isIdempotent(req.Method) || req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		res, err := cl.send(hc, req)
+		if attempt >= retries || ctx.Err() != nil || !cl.shouldRetry(res, err) {
+			return res, err
+		}
+
+		wait := cl.backoff(attempt)
+		if res != nil {
+			if after := parseSeconds(res.Header.Get(HeaderRetryAfter)); after > wait && after <= cl.MaxBackoff {
+				wait = after
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+//DecodeJSON 将响应体解析成对象
+//obj 转换结果
+//return 返回错误
+func (res *ClientResponse) DecodeJSON(obj interface{}) error {
+	return json.Unmarshal(res.Body, obj)
+}
+
+//Send 通过Engine.Client发送请求，随请求的context取消，并转发请求ID与追踪信息
+//method 请求方法
+//url 请求的地址
+//body 请求体
+//return 响应、错误
+func (c *Context) Send(method, url string, body []byte) (*ClientResponse, error) {
+	req, err := http.NewRequestWithContext(c.requestContext(), method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return c.SendRequest(req)
+}
+
+//SendRequest 通过Engine.Client发送自定义请求，未设置context时使用当前请求的context
+//req 请求
+//return 响应、错误
+func (c *Context) SendRequest(req *http.Request) (*ClientResponse, error) {
+	if req.Context() == context.Background() {
+		req = req.WithContext(c.requestContext())
+	}
+
+	cl := c.engine.Client
+	if cl == nil {
+		cl = NewClient()
+	}
+	for _, name := range cl.ForwardHeaders {
+		if req.Header.Get(name) == "" {
+			if v := c.Request().Header.Get(name); v != "" {
+				req.Header.Set(name, v)
+			}
+		}
+	}
+
+	//出站请求作为当前span的子调用，重试共用一个客户端span
+	span := startClientSpan(SpanFromContext(req.Context()), req)
+	res, err := cl.Do(req)
+	status := 0
+	if res != nil {
+		status = res.StatusCode
+	}
+	span.endClientSpan(status, err)
+	return res, err
+}
+
+//send: 发送一次请求
+func (cl *Client) send(hc *http.Client, req *http.Request) (*ClientResponse, error) {
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	if cl.MaxResponseSize > 0 {
+		r = io.LimitReader(resp.Body, cl.MaxResponseSize+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if cl.MaxResponseSize > 0 && int64(len(body)) > cl.MaxResponseSize {
+		return nil, errResponseTooLarge
+	}
+
+	return &ClientResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+//shouldRetry: 网络错误或响应状态码在RetryStatus中时重试
+func (cl *Client) shouldRetry(res *ClientResponse, err error) bool {
+	if err != nil {
+		return !errors.Is(err, errResponseTooLarge)
+	}
+	for _, code := range cl.RetryStatus {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+//backoff: 第attempt次重试前的等待时间，指数递增并加入随机抖动
+func (cl *Client) backoff(attempt int) time.Duration {
+	d := cl.RetryBackoff << uint(attempt)
+	if d <= 0 || cl.MaxBackoff > 0 && d > cl.MaxBackoff {
+		d = cl.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+//isIdempotent: 是否为幂等方法
+func isIdempotent(method string) bool {
+	switch method {
+	case GET, HEAD, OPTIONS, TRACE, PUT, DELETE:
+		return true
+	}
+	return false
+}
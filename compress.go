@@ -0,0 +1,338 @@
+package yun
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 内容编码
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+type (
+	//CompressConfig 响应压缩配置
+	CompressConfig struct {
+		//Level 压缩级别，取值同compress/flate，为0时使用gzip.DefaultCompression；不压缩时应使用Skipper跳过
+		Level int
+		//MinLength 响应体小于该字节数时不压缩
+		MinLength int
+		//ExcludedTypes 不压缩的内容类型，以"*"结尾时按前缀匹配，如"video/*"
+		ExcludedTypes []string
+		//Skipper 返回true时跳过压缩
+		Skipper func(*Context) bool
+	}
+
+	//compressWriter 延迟到响应体达到MinLength或刷新时再决定是否压缩
+	compressWriter struct {
+		ResponseWriter
+		cfg      *CompressConfig
+		encoding string
+		pool     *sync.Pool
+
+		status      int
+		wroteHeader bool
+		size        int
+		buf         []byte
+
+		decided  bool
+		hijacked bool
+		w        io.WriteCloser
+	}
+
+	//flateResetter 可复用的压缩器
+	flateResetter interface {
+		io.WriteCloser
+		Reset(io.Writer)
+		Flush() error
+	}
+)
+
+//DefaultCompressConfig 默认的压缩配置
+var DefaultCompressConfig = CompressConfig{
+	Level:     gzip.DefaultCompression,
+	MinLength: 1024,
+	ExcludedTypes: []string{
+		"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+		"video/*", "audio/*", "font/woff", "font/woff2",
+		"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-7z-compressed", "application/x-rar-compressed",
+	},
+}
+
+//Compress 响应压缩中间件，按Accept-Encoding的q值选择gzip或deflate
+//Range请求、已编码及排除类型的响应不压缩
+//config 压缩配置，为空时使用DefaultCompressConfig
+//return 中间件
+func Compress(config ...CompressConfig) HandlerFunc {
+	cfg := DefaultCompressConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Level == gzip.NoCompression {
+		cfg.Level = gzip.DefaultCompression
+	}
+	if cfg.Level < gzip.HuffmanOnly || cfg.Level > gzip.BestCompression {
+		panic("Invalid compression level: " + strconv.Itoa(cfg.Level))
+	}
+
+	pools := map[string]*sync.Pool{
+		EncodingGzip: {New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(io.Discard, cfg.Level)
+			return w
+		}},
+		EncodingDeflate: {New: func() interface{} {
+			w, _ := flate.NewWriter(io.Discard, cfg.Level)
+			return w
+		}},
+	}
+
+	return func(c *Context) {
+		if cfg.Skipper != nil && cfg.Skipper(c) {
+			c.Next()
+			return
+		}
+
+		req := c.Request()
+		addVary(c.Response().Header(), HeaderAcceptEncoding)
+		if req.Method == HEAD || req.Header.Get(HeaderRange) != "" {
+			c.Next()
+			return
+		}
+
+		encoding := negotiateEncoding(req.Header.Get(HeaderAcceptEncoding))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		prev := c.ResponseWriter
+		cw := &compressWriter{
+			ResponseWriter: prev,
+			cfg:            &cfg,
+			encoding:       encoding,
+			pool:           pools[encoding],
+			status:         http.StatusOK,
+			size:           noWritten,
+		}
+		c.ResponseWriter = cw
+		defer func() {
+			c.ResponseWriter = prev
+			cw.close()
+		}()
+
+		c.Next()
+	}
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = code
+	w.wroteHeader = true
+	if w.size < 0 {
+		w.size = 0
+	}
+
+	switch {
+	case w.decided:
+		w.ResponseWriter.WriteHeader(code)
+	case code < http.StatusOK, code == http.StatusNoContent, code == http.StatusNotModified:
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(w.status)
+	w.size += len(data)
+
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) >= w.cfg.MinLength {
+			w.decide(true)
+		}
+		return len(data), nil
+	}
+
+	if w.w != nil {
+		return w.w.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *compressWriter) Status() int {
+	return w.status
+}
+
+func (w *compressWriter) Size() int {
+	return w.size
+}
+
+// 流式响应刷新时即决定是否压缩，不再等待MinLength
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.WriteHeader(w.status)
+		w.decide(true)
+	}
+	if f, ok := w.w.(flateResetter); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.ResponseWriter.Hijack()
+}
+
+// 供http.ResponseController获取底层的ResponseWriter
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//decide: 写出响应头，compress为true且响应适合压缩时启用压缩器
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+
+	if compress && w.compressible(h) {
+		h.Del(HeaderContentLength)
+		h.Set(HeaderContentEncoding, w.encoding)
+		//压缩后的表示与原内容不同，强校验器降为弱校验器
+		if etag := h.Get(HeaderETag); strings.HasPrefix(etag, `"`) {
+			h.Set(HeaderETag, "W/"+etag)
+		}
+
+		fw := w.pool.Get().(flateResetter)
+		fw.Reset(w.ResponseWriter)
+		w.w = fw
+	}
+
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) > 0 {
+		buf := w.buf
+		w.buf = nil
+		if w.w != nil {
+			w.w.Write(buf)
+		} else {
+			w.ResponseWriter.Write(buf)
+		}
+	}
+}
+
+//compressible: 响应状态与内容类型是否适合压缩
+func (w *compressWriter) compressible(h http.Header) bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified ||
+		w.status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get(HeaderContentEncoding) != "" || h.Get(HeaderContentRange) != "" {
+		return false
+	}
+
+	ct := h.Get(HeaderContentType)
+	if ct == "" {
+		if len(w.buf) == 0 {
+			return false
+		}
+		ct = http.DetectContentType(w.buf)
+		h.Set(HeaderContentType, ct)
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return !matchPaths(w.cfg.ExcludedTypes, strings.ToLower(mediaType))
+}
+
+//close: 处理结束后写出剩余数据并归还压缩器
+func (w *compressWriter) close() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		if !w.wroteHeader {
+			return
+		}
+		w.decide(false)
+	}
+	if w.w != nil {
+		w.w.Close()
+		w.pool.Put(w.w)
+		w.w = nil
+	}
+}
+
+//negotiateEncoding: 按q值选择gzip或deflate，q值相同时优先gzip
+func negotiateEncoding(accept string) string {
+	if accept == "" {
+		return ""
+	}
+
+	q := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		weight := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					weight = f
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = weight
+		} else {
+			q[name] = weight
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{EncodingGzip, EncodingDeflate} {
+		weight, has := q[enc]
+		if !has && enc == EncodingGzip {
+			weight, has = q["x-gzip"]
+		}
+		if !has {
+			weight = wildcard
+		}
+		if weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+//addVary: 追加Vary响应头，已存在时不重复
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values(HeaderVary) {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token == "*" || strings.EqualFold(token, name) {
+				return
+			}
+		}
+	}
+	h.Add(HeaderVary, name)
+}
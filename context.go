@@ -1,11 +1,11 @@
 package yun
 
 import (
-	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"mime"
@@ -13,6 +13,9 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -27,7 +30,9 @@ type (
 		index    int16
 		hcount   int16
 
-		keys map[string]interface{}
+		keys     map[string]interface{}
+		engine   *Engine
+		fullPath string
 	}
 )
 
@@ -48,6 +53,7 @@ const (
 	MIMETextPlainCharsetUTF8             = MIMETextPlain + "; " + charsetUTF8
 	MIMEMultipartForm                    = "multipart/form-data"
 	MIMEOctetStream                      = "application/octet-stream"
+	MIMETextEventStream                  = "text/event-stream"
 )
 
 const (
@@ -58,24 +64,39 @@ const (
 // Headers
 const (
 	HeaderAcceptEncoding                = "Accept-Encoding"
+	HeaderAge                           = "Age"
 	HeaderAllow                         = "Allow"
 	HeaderAuthorization                 = "Authorization"
+	HeaderCacheControl                  = "Cache-Control"
+	HeaderConnection                    = "Connection"
 	HeaderContentDisposition            = "Content-Disposition"
 	HeaderContentEncoding               = "Content-Encoding"
 	HeaderContentLength                 = "Content-Length"
 	HeaderContentType                   = "Content-Type"
+	HeaderContentRange                  = "Content-Range"
 	HeaderCookie                        = "Cookie"
+	HeaderETag                          = "ETag"
 	HeaderSetCookie                     = "Set-Cookie"
 	HeaderIfModifiedSince               = "If-Modified-Since"
+	HeaderIfNoneMatch                   = "If-None-Match"
 	HeaderLastModified                  = "Last-Modified"
+	HeaderLastEventID                   = "Last-Event-ID"
 	HeaderLocation                      = "Location"
+	HeaderRange                         = "Range"
 	HeaderUpgrade                       = "Upgrade"
 	HeaderVary                          = "Vary"
 	HeaderWWWAuthenticate               = "WWW-Authenticate"
+	HeaderForwarded                     = "Forwarded"
 	HeaderXForwardedProto               = "X-Forwarded-Proto"
 	HeaderXHTTPMethodOverride           = "X-HTTP-Method-Override"
+	HeaderXAPIKey                       = "X-API-Key"
 	HeaderXForwardedFor                 = "X-Forwarded-For"
+	HeaderXForwardedHost                = "X-Forwarded-Host"
 	HeaderXRealIP                       = "X-Real-IP"
+	HeaderXRequestID                    = "X-Request-ID"
+	HeaderXCache                        = "X-Cache"
+	HeaderTraceparent                   = "Traceparent"
+	HeaderTracestate                    = "Tracestate"
 	HeaderServer                        = "Server"
 	HeaderOrigin                        = "Origin"
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -86,14 +107,20 @@ const (
 	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
 	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
 	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+	HeaderRateLimitLimit                = "RateLimit-Limit"
+	HeaderRateLimitRemaining            = "RateLimit-Remaining"
+	HeaderRateLimitReset                = "RateLimit-Reset"
+	HeaderRetryAfter                    = "Retry-After"
 
 	// Security
-	HeaderStrictTransportSecurity = "Strict-Transport-Security"
-	HeaderXContentTypeOptions     = "X-Content-Type-Options"
-	HeaderXXSSProtection          = "X-XSS-Protection"
-	HeaderXFrameOptions           = "X-Frame-Options"
-	HeaderContentSecurityPolicy   = "Content-Security-Policy"
-	HeaderXCSRFToken              = "X-CSRF-Token"
+	HeaderStrictTransportSecurity         = "Strict-Transport-Security"
+	HeaderXContentTypeOptions             = "X-Content-Type-Options"
+	HeaderXXSSProtection                  = "X-XSS-Protection"
+	HeaderXFrameOptions                   = "X-Frame-Options"
+	HeaderContentSecurityPolicy           = "Content-Security-Policy"
+	HeaderContentSecurityPolicyReportOnly = "Content-Security-Policy-Report-Only"
+	HeaderReferrerPolicy                  = "Referrer-Policy"
+	HeaderXCSRFToken                      = "X-CSRF-Token"
 )
 
 func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
@@ -105,6 +132,12 @@ func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
 	c.Params = c.Params[0:0]
 	c.handlers = nil
 	c.hcount = 0
+	c.fullPath = ""
+}
+
+//FullPath 获取匹配的路由路径，如"/users/:id"，未匹配路由时为空
+func (c *Context) FullPath() string {
+	return c.fullPath
 }
 
 //Request 获取请求
@@ -218,16 +251,91 @@ func (c *Context) File(file string) {
 	http.ServeFile(c.Response(), c.Request(), file)
 }
 
-//Attachment 响应附件
+//Attachment 响应附件，支持Range、多段Range、If-None-Match、If-Modified-Since等条件请求
+//未设置ETag时，r可获取文件信息（如*os.File）则按大小与修改时间生成，否则不生成，需要时由调用方预先设置ETag响应头
 //r 文件读取接口
 //name 文件名
 //return 返回错误
 func (c *Context) Attachment(r io.ReadSeeker, name string) (err error) {
-	c.Response().Header().Set(HeaderContentType, ContentTypeByExtension(name))
-	c.Response().Header().Set(HeaderContentDisposition, "attachment; filename="+name)
-	c.WriteHeader(http.StatusOK)
-	_, err = io.Copy(c.ResponseWriter, r)
-	return
+	h := c.Response().Header()
+	if h.Get(HeaderContentType) == "" {
+		h.Set(HeaderContentType, ContentTypeByExtension(name))
+	}
+	h.Set(HeaderContentDisposition, ContentDisposition("attachment", name))
+
+	var modTime time.Time
+	if st, ok := r.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if info, err := st.Stat(); err == nil && info.Mode().IsRegular() {
+			modTime = info.ModTime()
+			if h.Get(HeaderETag) == "" {
+				h.Set(HeaderETag, FileETag(info.Size(), modTime))
+			}
+		}
+	}
+
+	http.ServeContent(c.ResponseWriter, c.Request(), name, modTime, r)
+	return nil
+}
+
+//ContentDisposition 按RFC 6266生成Content-Disposition，非ASCII文件名同时以RFC 5987编码
+//typ 类型，如"attachment"、"inline"
+//name 文件名
+//return 响应头的值
+func ContentDisposition(typ, name string) string {
+	ascii := true
+	fallback := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		switch {
+		case b >= utf8.RuneSelf:
+			ascii = false
+			//多字节字符只保留一个替代字符
+			if utf8.RuneStart(b) {
+				fallback = append(fallback, '_')
+			}
+		case b < 0x20 || b == 0x7f:
+			ascii = false
+			fallback = append(fallback, '_')
+		case b == '"' || b == '\\':
+			fallback = append(fallback, '\\', b)
+		default:
+			fallback = append(fallback, b)
+		}
+	}
+
+	v := typ + `; filename="` + string(fallback) + `"`
+	if !ascii {
+		v += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return v
+}
+
+//encodeRFC5987: 按RFC 5987的attr-char对值进行百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	b := make([]byte, 0, len(s)*3)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", ch) >= 0 {
+			b = append(b, ch)
+		} else {
+			b = append(b, '%', hex[ch>>4], hex[ch&0x0f])
+		}
+	}
+	return string(b)
+}
+
+//Push 通过HTTP/2服务端推送资源
+//target 资源路径
+//opts 推送选项，可选
+//return 返回错误，连接不支持推送时为http.ErrNotSupported
+func (c *Context) Push(target string, opts ...*http.PushOptions) error {
+	var opt *http.PushOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return c.ResponseWriter.Push(target, opt)
 }
 
 //NoContent 无内容响应
@@ -267,33 +375,6 @@ func (c *Context) Get(key string) (value interface{}, exists bool) {
 	return
 }
 
-//Send 发送请求
-//method 请求方法
-//url 请求的地址
-//body 请求体
-//return 返回响应体、响应状态码、错误
-func (c *Context) Send(method, url string, body []byte) ([]byte, int, error) {
-	client := new(http.Client)
-	b := bytes.NewBuffer(body)
-	req, err := http.NewRequest(method, url, b)
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, http.StatusInternalServerError, err
-	}
-	defer resp.Body.Close()
-
-	res, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, resp.StatusCode, err
-	}
-
-	return res, resp.StatusCode, nil
-}
-
 //Form 获取字符串类型的非必须参数
 //key 参数名称
 //retrun 返回字符串值
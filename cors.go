@@ -0,0 +1,152 @@
+package yun
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	//CORSConfig 跨域资源共享配置
+	CORSConfig struct {
+		//AllowOrigins 允许的来源，支持"*"及"https://*.example.com"形式的子域名通配
+		AllowOrigins []string
+		//AllowOriginFunc 自定义来源校验，设置后AllowOrigins不再生效
+		AllowOriginFunc func(origin string) bool
+		//AllowMethods 预检允许的方法
+		AllowMethods []string
+		//AllowHeaders 预检允许的请求头，为空时回显请求的Access-Control-Request-Headers
+		AllowHeaders []string
+		//ExposeHeaders 允许客户端读取的响应头
+		ExposeHeaders []string
+		//AllowCredentials 是否允许携带凭证，不能与AllowOrigins中的"*"同时使用，须列出来源或设置AllowOriginFunc
+		AllowCredentials bool
+		//MaxAge 预检结果的缓存秒数，为0时不发送
+		MaxAge int
+	}
+)
+
+//DefaultCORSConfig 默认的跨域配置，允许全部来源
+var DefaultCORSConfig = CORSConfig{
+	AllowOrigins: []string{"*"},
+	AllowMethods: []string{GET, HEAD, PUT, PATCH, POST, DELETE},
+}
+
+//CORS 跨域资源共享中间件，可用于全局或路由组
+//预检请求在中间件内应答并中止，未注册OPTIONS的路由同样适用
+//config 跨域配置，为空时使用DefaultCORSConfig
+//return 中间件
+func CORS(config ...CORSConfig) HandlerFunc {
+	cfg := DefaultCORSConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.AllowMethods) == 0 {
+		cfg.AllowMethods = DefaultCORSConfig.AllowMethods
+	}
+
+	allowAll := false
+	origins := make([]string, 0, len(cfg.AllowOrigins))
+	for _, o := range cfg.AllowOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+		origins = append(origins, strings.ToLower(o))
+	}
+	//允许任意来源携带凭证等同于关闭同源策略
+	if allowAll && cfg.AllowCredentials && cfg.AllowOriginFunc == nil {
+		panic("CORS AllowOrigins \"*\" cannot be used with AllowCredentials, list the origins or set AllowOriginFunc")
+	}
+
+	allowMethods := strings.Join(cfg.AllowMethods, ",")
+	allowHeaders := strings.Join(cfg.AllowHeaders, ",")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ",")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	allowed := func(origin string) bool {
+		if cfg.AllowOriginFunc != nil {
+			return cfg.AllowOriginFunc(origin)
+		}
+		if allowAll {
+			return true
+		}
+
+		origin = strings.ToLower(origin)
+		for _, o := range origins {
+			if o == origin || matchWildcardOrigin(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *Context) {
+		req := c.Request()
+		h := c.Response().Header()
+		origin := req.Header.Get(HeaderOrigin)
+		preflight := req.Method == OPTIONS && req.Header.Get(HeaderAccessControlRequestMethod) != ""
+
+		h.Add(HeaderVary, HeaderOrigin)
+		if preflight {
+			h.Add(HeaderVary, HeaderAccessControlRequestMethod)
+			h.Add(HeaderVary, HeaderAccessControlRequestHeaders)
+		}
+
+		if origin == "" || !allowed(origin) {
+			if preflight {
+				c.NoContent(http.StatusNoContent)
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if allowAll && cfg.AllowOriginFunc == nil {
+			h.Set(HeaderAccessControlAllowOrigin, "*")
+		} else {
+			h.Set(HeaderAccessControlAllowOrigin, origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set(HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				h.Set(HeaderAccessControlExposeHeaders, exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		h.Set(HeaderAccessControlAllowMethods, allowMethods)
+		if allowHeaders != "" {
+			h.Set(HeaderAccessControlAllowHeaders, allowHeaders)
+		} else if reqHeaders := req.Header.Get(HeaderAccessControlRequestHeaders); reqHeaders != "" {
+			h.Set(HeaderAccessControlAllowHeaders, reqHeaders)
+		}
+		if cfg.MaxAge > 0 {
+			h.Set(HeaderAccessControlMaxAge, maxAge)
+		}
+
+		c.NoContent(http.StatusNoContent)
+		c.Abort()
+	}
+}
+
+//matchWildcardOrigin: 匹配"https://*.example.com"形式的子域名通配
+func matchWildcardOrigin(pattern, origin string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return false
+	}
+
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:@")
+}
@@ -0,0 +1,259 @@
+package yun
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//csrfKey 当前请求的CSRF令牌在Context中保存的键
+const csrfKey = "csrf-token"
+
+type (
+	//CSRFConfig 跨站请求伪造防护配置
+	CSRFConfig struct {
+		//TokenLength 令牌的随机字节数
+		TokenLength int
+		//TokenLookup 提交令牌的查找位置，按顺序尝试，如"header:X-CSRF-Token,form:_csrf,query:_csrf"
+		TokenLookup string
+		//Store 同步令牌的服务端存储，为nil时使用双重提交Cookie
+		Store CSRFStore
+
+		//CookieName 双重提交Cookie的名称
+		CookieName string
+		//CookiePath Cookie的路径
+		CookiePath string
+		//CookieDomain Cookie的域名
+		CookieDomain string
+		//CookieMaxAge Cookie的有效秒数
+		CookieMaxAge int
+		//CookieSecure Cookie是否仅通过https发送
+		CookieSecure bool
+		//CookieHTTPOnly Cookie是否禁止脚本读取
+		CookieHTTPOnly bool
+		//CookieSameSite Cookie的SameSite属性
+		CookieSameSite http.SameSite
+
+		//ExemptPaths 豁免校验的路径，以"*"结尾时按前缀匹配
+		ExemptPaths []string
+		//TrustedOrigins 除本站外允许提交的来源，如"https://app.example.com"
+		TrustedOrigins []string
+		//Skipper 返回true时跳过校验
+		Skipper func(*Context) bool
+		//ErrorHandler 校验失败时执行，为nil时响应403
+		ErrorHandler HandlerFunc
+	}
+
+	//CSRFStore 同步令牌的服务端存储，如基于会话的实现
+	CSRFStore interface {
+		//Token 获取请求对应会话的令牌，不存在时返回空字符串
+		Token(*Context) string
+		//SetToken 保存请求对应会话的令牌
+		SetToken(*Context, string)
+	}
+
+	//csrfExtractor 从请求中提取提交的令牌
+	csrfExtractor func(*Context) string
+)
+
+//DefaultCSRFConfig 默认的CSRF配置
+var DefaultCSRFConfig = CSRFConfig{
+	TokenLength:    32,
+	TokenLookup:    "header:" + HeaderXCSRFToken + ",form:_csrf",
+	CookieName:     "_csrf",
+	CookiePath:     "/",
+	CookieMaxAge:   86400,
+	CookieHTTPOnly: true,
+	CookieSameSite: http.SameSiteLaxMode,
+}
+
+//CSRF 跨站请求伪造防护中间件
+//GET、HEAD、OPTIONS、TRACE请求只下发令牌，其他请求须提交与之一致的令牌并通过来源校验
+//config CSRF配置，为空时使用DefaultCSRFConfig
+//return 中间件
+func CSRF(config ...CSRFConfig) HandlerFunc {
+	cfg := DefaultCSRFConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.TokenLength <= 0 {
+		cfg.TokenLength = DefaultCSRFConfig.TokenLength
+	}
+	if cfg.TokenLookup == "" {
+		cfg.TokenLookup = DefaultCSRFConfig.TokenLookup
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultCSRFConfig.CookieName
+	}
+	if cfg.CookiePath == "" {
+		cfg.CookiePath = DefaultCSRFConfig.CookiePath
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = func(c *Context) {
+			c.String(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		}
+	}
+
+	extractors := csrfExtractors(cfg.TokenLookup)
+
+	return func(c *Context) {
+		req := c.Request()
+		if cfg.Skipper != nil && cfg.Skipper(c) || matchPaths(cfg.ExemptPaths, req.URL.Path) {
+			c.Next()
+			return
+		}
+
+		token := cfg.storedToken(c)
+		if token == "" {
+			token = newCSRFToken(cfg.TokenLength)
+			cfg.storeToken(c, token)
+		}
+		c.Set(csrfKey, token)
+
+		switch req.Method {
+		case GET, HEAD, OPTIONS, TRACE:
+			c.Next()
+			return
+		}
+
+		if !cfg.checkOrigin(c) {
+			cfg.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+
+		submitted := ""
+		for _, extract := range extractors {
+			if submitted = extract(c); submitted != "" {
+				break
+			}
+		}
+		if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			cfg.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+//CSRFToken 获取当前请求的CSRF令牌，用于注入模板或响应
+//return 令牌，未使用CSRF中间件时为空
+func (c *Context) CSRFToken() string {
+	if v, ok := c.Get(csrfKey); ok {
+		token, _ := v.(string)
+		return token
+	}
+	return ""
+}
+
+//storedToken: 获取已下发的令牌
+func (cfg *CSRFConfig) storedToken(c *Context) string {
+	if cfg.Store != nil {
+		return cfg.Store.Token(c)
+	}
+	if cookie, err := c.Request().Cookie(cfg.CookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+//storeToken: 保存新生成的令牌
+func (cfg *CSRFConfig) storeToken(c *Context, token string) {
+	if cfg.Store != nil {
+		cfg.Store.SetToken(c, token)
+		return
+	}
+
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     cfg.CookieName,
+		Value:    token,
+		Path:     cfg.CookiePath,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   cfg.CookieMaxAge,
+		Secure:   cfg.CookieSecure,
+		HttpOnly: cfg.CookieHTTPOnly,
+		SameSite: cfg.CookieSameSite,
+	})
+}
+
+//checkOrigin: 校验Origin或Referer是否为本站或可信来源，https请求必须携带其一
+func (cfg *CSRFConfig) checkOrigin(c *Context) bool {
+	req := c.Request()
+	source := req.Header.Get(HeaderOrigin)
+	if source == "" || source == "null" {
+		source = req.Referer()
+	}
+	if source == "" {
+		return !c.engine.isHTTPS(req)
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, o := range cfg.TrustedOrigins {
+		if strings.ToLower(o) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+//csrfExtractors: 解析令牌的查找位置
+func csrfExtractors(lookup string) []csrfExtractor {
+	var extractors []csrfExtractor
+	for _, part := range strings.Split(lookup, ",") {
+		source, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			panic("Wrong CSRF token lookup format: " + part)
+		}
+
+		switch source {
+		case "header":
+			extractors = append(extractors, func(c *Context) string {
+				return c.Request().Header.Get(name)
+			})
+		case "form":
+			extractors = append(extractors, func(c *Context) string {
+				return c.Request().PostFormValue(name)
+			})
+		case "query":
+			extractors = append(extractors, func(c *Context) string {
+				return c.Form(name)
+			})
+		default:
+			panic("Unknown CSRF token lookup source: " + source)
+		}
+	}
+	return extractors
+}
+
+//matchPaths: 路径是否匹配列表中的任一项，以"*"结尾时按前缀匹配
+func matchPaths(paths []string, p string) bool {
+	for _, s := range paths {
+		if strings.HasSuffix(s, "*") {
+			if strings.HasPrefix(p, s[:len(s)-1]) {
+				return true
+			}
+		} else if s == p {
+			return true
+		}
+	}
+	return false
+}
+
+func newCSRFToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
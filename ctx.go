@@ -0,0 +1,142 @@
+package yun
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type (
+	//discardWriter 丢弃全部写入的响应，供脱离请求的Context使用
+	discardWriter struct {
+		header http.Header
+	}
+)
+
+var _ context.Context = (*Context)(nil)
+
+//Deadline 实现context.Context，返回请求的截止时间
+func (c *Context) Deadline() (time.Time, bool) {
+	return c.requestContext().Deadline()
+}
+
+//Done 实现context.Context，请求结束或被取消时关闭
+func (c *Context) Done() <-chan struct{} {
+	return c.requestContext().Done()
+}
+
+//Err 实现context.Context，返回请求被取消的原因
+func (c *Context) Err() error {
+	return c.requestContext().Err()
+}
+
+//Value 实现context.Context，先从请求的context.Context中查找，字符串键不存在时再从Set保存的值中查找
+//key 键值
+//return 返回值，不存在时为nil
+func (c *Context) Value(key interface{}) interface{} {
+	if v := c.requestContext().Value(key); v != nil {
+		return v
+	}
+	if k, ok := key.(string); ok {
+		if v, has := c.Get(k); has {
+			return v
+		}
+	}
+	return nil
+}
+
+//SetContext 替换请求的context.Context
+//ctx 新的上下文
+func (c *Context) SetContext(ctx context.Context) {
+	c.request = c.request.WithContext(ctx)
+}
+
+//WithValue 在请求的context.Context中保存值
+//key 键值
+//value 值
+func (c *Context) WithValue(key, value interface{}) {
+	c.SetContext(context.WithValue(c.requestContext(), key, value))
+}
+
+//WithCancel 使请求的context.Context可被取消
+//return 取消函数
+func (c *Context) WithCancel() context.CancelFunc {
+	ctx, cancel := context.WithCancel(c.requestContext())
+	c.SetContext(ctx)
+	return cancel
+}
+
+//WithTimeout 为请求的context.Context设置超时
+//d 超时时间
+//return 取消函数
+func (c *Context) WithTimeout(d time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithTimeout(c.requestContext(), d)
+	c.SetContext(ctx)
+	return cancel
+}
+
+//WithDeadline 为请求的context.Context设置截止时间
+//t 截止时间
+//return 取消函数
+func (c *Context) WithDeadline(t time.Time) context.CancelFunc {
+	ctx, cancel := context.WithDeadline(c.requestContext(), t)
+	c.SetContext(ctx)
+	return cancel
+}
+
+//Copy 复制Context，副本可在处理函数返回后于其他goroutine中使用
+//副本保留请求、参数与保存的值，不随请求结束而取消，写入的响应将被丢弃
+//return 返回副本
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		engine:   c.engine,
+		index:    outside,
+		fullPath: c.fullPath,
+	}
+	cp.tempwriter.reset(&discardWriter{header: c.Response().Header().Clone()})
+	cp.ResponseWriter = &cp.tempwriter
+	cp.request = c.request.WithContext(context.WithoutCancel(c.requestContext()))
+
+	if len(c.Params) > 0 {
+		cp.Params = make(Params, len(c.Params))
+		copy(cp.Params, c.Params)
+	}
+
+	if c.keys != nil {
+		cp.keys = make(map[string]interface{}, len(c.keys))
+		for k, v := range c.keys {
+			cp.keys[k] = v
+		}
+	}
+
+	return cp
+}
+
+//fork: 创建使用指定响应写入器、可继续执行剩余handler的副本，副本与原请求共享context
+func (c *Context) fork(w ResponseWriter) *Context {
+	cp := c.Copy()
+	cp.request = c.request
+	cp.ResponseWriter = w
+	cp.handlers = c.handlers
+	cp.index = c.index
+	cp.hcount = c.hcount
+	return cp
+}
+
+//requestContext: 获取请求的context.Context
+func (c *Context) requestContext() context.Context {
+	if c.request == nil {
+		return context.Background()
+	}
+	return c.request.Context()
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
@@ -0,0 +1,214 @@
+package yun
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	//ETagConfig ETag中间件配置
+	ETagConfig struct {
+		//Weak 是否生成弱校验器
+		Weak bool
+		//MaxSize 缓冲的最大字节数，超出时直接写出且不生成ETag
+		MaxSize int
+		//Skipper 返回true时跳过
+		Skipper func(*Context) bool
+	}
+
+	//etagWriter 缓冲响应体以计算ETag，超出上限或刷新时转为直接写出
+	etagWriter struct {
+		ResponseWriter
+		max int
+
+		status      int
+		wroteHeader bool
+		size        int
+		buf         bytes.Buffer
+		passthrough bool
+	}
+)
+
+//DefaultETagConfig 默认的ETag配置
+var DefaultETagConfig = ETagConfig{
+	MaxSize: 1 << 20,
+}
+
+//ETag 为GET、HEAD请求的200响应按内容生成ETag，If-None-Match匹配时响应304
+//流式（调用Flush）及超过MaxSize的响应不做处理，处理函数已设置ETag时沿用
+//config ETag配置，为空时使用DefaultETagConfig
+//return 中间件
+func ETag(config ...ETagConfig) HandlerFunc {
+	cfg := DefaultETagConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultETagConfig.MaxSize
+	}
+
+	return func(c *Context) {
+		req := c.Request()
+		if req.Method != GET && req.Method != HEAD || cfg.Skipper != nil && cfg.Skipper(c) {
+			c.Next()
+			return
+		}
+
+		prev := c.ResponseWriter
+		ew := &etagWriter{ResponseWriter: prev, max: cfg.MaxSize, status: http.StatusOK, size: noWritten}
+		c.ResponseWriter = ew
+		defer func() {
+			c.ResponseWriter = prev
+		}()
+
+		c.Next()
+
+		if ew.passthrough || !ew.wroteHeader {
+			return
+		}
+		if ew.status != http.StatusOK {
+			ew.writeBuffer()
+			return
+		}
+
+		h := prev.Header()
+		tag := h.Get(HeaderETag)
+		if tag == "" {
+			tag = GenerateETag(ew.buf.Bytes(), cfg.Weak)
+			h.Set(HeaderETag, tag)
+		}
+
+		if matchETag(req.Header.Get(HeaderIfNoneMatch), tag) {
+			h.Del(HeaderContentType)
+			h.Del(HeaderContentLength)
+			prev.WriteHeader(http.StatusNotModified)
+			ew.passthrough = true
+			return
+		}
+		ew.writeBuffer()
+	}
+}
+
+//GenerateETag 按内容摘要生成ETag
+//data 响应内容
+//weak 是否生成弱校验器
+//return ETag
+func GenerateETag(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	return formatETag(sum[:], weak)
+}
+
+//FileETag 按文件大小与修改时间生成强校验器
+//size 文件大小
+//modTime 修改时间
+//return ETag
+func FileETag(size int64, modTime time.Time) string {
+	return `"` + strconv.FormatInt(modTime.UnixNano(), 36) + "-" + strconv.FormatInt(size, 36) + `"`
+}
+
+//formatETag: 取摘要的前16字节作为ETag
+func formatETag(sum []byte, weak bool) string {
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+//matchETag: If-None-Match是否与ETag匹配，按弱比较
+func matchETag(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = code
+	w.wroteHeader = true
+	if w.size < 0 {
+		w.size = 0
+	}
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(w.status)
+	w.size += len(data)
+
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() > w.max {
+		if err := w.writeBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *etagWriter) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *etagWriter) Status() int {
+	return w.status
+}
+
+func (w *etagWriter) Size() int {
+	return w.size
+}
+
+// 流式响应不生成ETag
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		w.WriteHeader(w.status)
+		w.writeBuffer()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.passthrough = true
+	return w.ResponseWriter.Hijack()
+}
+
+// 供http.ResponseController获取底层的ResponseWriter
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//writeBuffer: 转为直接写出并写出已缓冲的内容
+func (w *etagWriter) writeBuffer() error {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
@@ -0,0 +1,236 @@
+package yun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	//stdoutExporter 每行输出一个JSON格式的span
+	stdoutExporter struct {
+		lock sync.Mutex
+		enc  *json.Encoder
+	}
+
+	//OTLPExporter 通过OTLP/HTTP（JSON编码）导出span，如发送到OpenTelemetry Collector
+	OTLPExporter struct {
+		//Endpoint 接收地址，如"http://localhost:4318/v1/traces"
+		Endpoint string
+		//ServiceName 资源属性service.name
+		ServiceName string
+		//Headers 附加的请求头，如认证信息
+		Headers map[string]string
+		//Client 发送使用的http客户端，为nil时使用http.DefaultClient
+		Client *http.Client
+	}
+
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+//NewStdoutExporter 创建每行输出一个JSON格式span的导出器
+//w 输出，为nil时使用os.Stdout
+//return 导出器
+func NewStdoutExporter(w io.Writer) SpanExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &stdoutExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *stdoutExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, s := range spans {
+		if err := e.enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *stdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+//NewOTLPExporter 创建OTLP/HTTP导出器
+//endpoint 接收地址，如"http://localhost:4318/v1/traces"
+//serviceName 服务名称
+//return 导出器
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{Endpoint: endpoint, ServiceName: serviceName}
+}
+
+//ExportSpans 以一个请求发送一批span，响应非2xx时返回错误
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/lnhlg/yun"}, Spans: make([]otlpSpan, len(spans))}
+	for i, s := range spans {
+		scope.Spans[i] = toOTLPSpan(s)
+	}
+	payload := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": e.ServiceName})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, POST, e.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	hc := e.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.New("otlp export: " + resp.Status + " " + string(bytes.TrimSpace(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+//Shutdown 关闭导出器
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+//toOTLPSpan: 转换为OTLP的span，ID为十六进制，时间为字符串形式的纳秒数
+func toOTLPSpan(s *SpanData) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		TraceState:        s.TraceState,
+		Name:              s.Name,
+		Kind:              int(s.Kind),
+		StartTimeUnixNano: unixNano(s.Start),
+		EndTimeUnixNano:   unixNano(s.End),
+		Attributes:        otlpAttributes(s.Attributes),
+		Status:            otlpStatus{Code: int(s.Status), Message: s.StatusMessage},
+	}
+	if s.ParentSpanID.IsValid() {
+		span.ParentSpanID = s.ParentSpanID.String()
+	}
+	for _, ev := range s.Events {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: unixNano(ev.Time),
+			Name:         ev.Name,
+			Attributes:   otlpAttributes(ev.Attributes),
+		})
+	}
+	return span
+}
+
+//otlpAttributes: 转换属性，不支持的类型按字符串处理
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		var val otlpValue
+		switch x := v.(type) {
+		case string:
+			val.StringValue = &x
+		case bool:
+			val.BoolValue = &x
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+			s := fmt.Sprint(x)
+			val.IntValue = &s
+		case float32:
+			f := float64(x)
+			val.DoubleValue = &f
+		case float64:
+			val.DoubleValue = &x
+		default:
+			s := fmt.Sprint(x)
+			val.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: val})
+	}
+	return kvs
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,91 @@
+package yun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//TestOTLPExporter 以本地的模拟Collector接收Tracing导出的span
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != POST || req.Header.Get(HeaderContentType) != MIMEApplicationJSON || req.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var payload otlpRequest
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- payload
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL+"/v1/traces", "test")
+	exporter.Headers = map[string]string{"Authorization": "token"}
+
+	eng := New(RELEASE)
+	eng.Use(Tracing(TracingConfig{Exporter: exporter, Engine: eng}))
+	eng.Handle("/users/:id").Get(func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest(GET, "/users/1", nil)
+	req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	eng.ServeHTTP(httptest.NewRecorder(), req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := eng.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload otlpRequest
+	select {
+	case payload = <-received:
+	default:
+		t.Fatal("collector received no spans")
+	}
+	if len(payload.ResourceSpans) != 1 || len(payload.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+	if v := payload.ResourceSpans[0].Resource.Attributes; len(v) != 1 || v[0].Key != "service.name" || *v[0].Value.StringValue != "test" {
+		t.Fatalf("unexpected resource attributes: %+v", v)
+	}
+
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected trace context: %s %s", span.TraceID, span.ParentSpanID)
+	}
+	if span.Name != "GET /users/:id" || span.Kind != int(SpanKindServer) {
+		t.Errorf("unexpected span: %s %d", span.Name, span.Kind)
+	}
+	for _, kv := range span.Attributes {
+		if kv.Key == "http.response.status_code" && (kv.Value.IntValue == nil || *kv.Value.IntValue != "200") {
+			t.Errorf("unexpected status code: %+v", kv.Value)
+		}
+	}
+}
+
+//TestOTLPExporterError Collector返回非2xx时返回错误
+func TestOTLPExporterError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, "test")
+	err := exporter.ExportSpans(context.Background(), []*SpanData{{Name: "span", TraceID: newTraceID(), SpanID: newSpanID()}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
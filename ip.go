@@ -0,0 +1,131 @@
+package yun
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+//SetTrustedProxies 设置可信代理，只有来自可信代理的请求才会解析转发头
+//cidrs CIDR或单个IP地址
+//return 返回错误
+func (eng *Engine) SetTrustedProxies(cidrs ...string) error {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	eng.TrustedProxies = prefixes
+	return nil
+}
+
+//ClientIP 获取客户端IP
+//直接连接的对端为可信代理时，依次从Forwarded、X-Forwarded-For中自右向左取第一个非可信代理的地址，
+//其次使用X-Real-IP，否则返回对端地址
+//return 客户端IP
+func (c *Context) ClientIP() string {
+	req := c.Request()
+	peer := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	peerAddr, err := netip.ParseAddr(peer)
+	if err != nil || !c.engine.isTrustedProxy(peerAddr) {
+		return peer
+	}
+
+	chain := forwardedChain(req.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(chain[i])
+		if err != nil {
+			break
+		}
+		if !c.engine.isTrustedProxy(addr) || i == 0 {
+			return addr.Unmap().String()
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(req.Header.Get(HeaderXRealIP))); err == nil {
+		return addr.Unmap().String()
+	}
+	return peer
+}
+
+//isTrustedProxy: 地址是否属于可信代理
+func (eng *Engine) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range eng.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+//isTrustedPeer: 直接连接的对端是否为可信代理
+func (eng *Engine) isTrustedPeer(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && eng.isTrustedProxy(addr)
+}
+
+//forwardedChain: 获取转发链上的地址，最右侧为最近的代理添加
+func forwardedChain(h http.Header) []string {
+	var chain []string
+	if values := h.Values(HeaderForwarded); len(values) > 0 {
+		for _, v := range values {
+			for _, elem := range strings.Split(v, ",") {
+				chain = append(chain, forwardedFor(elem))
+			}
+		}
+		return chain
+	}
+
+	for _, v := range h.Values(HeaderXForwardedFor) {
+		for _, ip := range strings.Split(v, ",") {
+			chain = append(chain, strings.TrimSpace(ip))
+		}
+	}
+	return chain
+}
+
+//forwardedFor: 解析RFC 7239 Forwarded元素中的for参数
+func forwardedFor(elem string) string {
+	for _, pair := range strings.Split(elem, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(k, "for") {
+			continue
+		}
+
+		v = strings.Trim(v, `"`)
+		if strings.HasPrefix(v, "[") {
+			if end := strings.IndexByte(v, ']'); end > 0 {
+				return v[1:end]
+			}
+			return ""
+		}
+		if host, _, err := net.SplitHostPort(v); err == nil {
+			return host
+		}
+		return v
+	}
+	return ""
+}
@@ -0,0 +1,454 @@
+package yun
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWT签名算法
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+//jwksCheckInterval 检查JWKS文件变化的最小间隔
+const jwksCheckInterval = time.Second
+
+var (
+	errTokenMalformed = errors.New("token is malformed")
+	errTokenSignature = errors.New("token signature is invalid")
+	errTokenExpired   = errors.New("token is expired")
+	errTokenNotValid  = errors.New("token is not valid yet")
+)
+
+type (
+	//JWTConfig JWT认证配置
+	JWTConfig struct {
+		//Secret HS256的密钥
+		Secret []byte
+		//PublicKeys RS256、ES256的公钥（*rsa.PublicKey或*ecdsa.PublicKey），键为kid，令牌未携带kid时使用空键
+		PublicKeys map[string]crypto.PublicKey
+		//JWKSFile JSON Web Key Set文件，文件修改后自动重新加载
+		JWKSFile string
+		//Algorithms 允许的签名算法，为空时按已配置的密钥推断
+		Algorithms []string
+
+		//Issuer 要求的iss，为空时不校验
+		Issuer string
+		//Audience 要求aud中包含的值，为空时不校验
+		Audience string
+		//Leeway 校验exp、nbf、iat时允许的时钟偏差
+		Leeway time.Duration
+		//RequiredClaims 必须存在的声明
+		RequiredClaims []string
+		//Validate 自定义声明校验
+		Validate func(JWTClaims, *Context) error
+
+		//TokenCookie 未携带Authorization请求头时读取令牌的Cookie名称，为空时不读取
+		TokenCookie string
+	}
+
+	//JWTClaims JWT的声明
+	JWTClaims map[string]interface{}
+
+	//jwtVerifier JWT校验器
+	jwtVerifier struct {
+		cfg        JWTConfig
+		algorithms map[string]bool
+
+		lock    sync.RWMutex
+		jwks    map[string]crypto.PublicKey
+		modTime time.Time
+		checked time.Time
+	}
+
+	//jsonWebKey JWKS中的密钥
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		K   string `json:"k"`
+	}
+)
+
+//JWT JWT认证中间件，校验通过后以JWTClaims作为认证主体保存到Context
+//config JWT配置
+//return 中间件
+func JWT(config JWTConfig) HandlerFunc {
+	v := &jwtVerifier{cfg: config, algorithms: make(map[string]bool)}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		if len(config.Secret) > 0 {
+			algorithms = append(algorithms, HS256)
+		}
+		if len(config.PublicKeys) > 0 || config.JWKSFile != "" {
+			algorithms = append(algorithms, RS256, ES256)
+		}
+	}
+	for _, alg := range algorithms {
+		v.algorithms[alg] = true
+	}
+
+	if config.JWKSFile != "" {
+		if err := v.loadJWKS(); err != nil {
+			panic(err)
+		}
+	}
+
+	return func(c *Context) {
+		token := bearerToken(c.Request())
+		if token == "" && config.TokenCookie != "" {
+			if cookie, err := c.Request().Cookie(config.TokenCookie); err == nil {
+				token = cookie.Value
+			}
+		}
+		if token == "" {
+			unauthorized(c, `Bearer realm="Restricted"`)
+			return
+		}
+
+		claims, err := v.verify(token, c)
+		if err != nil {
+			unauthorized(c, `Bearer error="invalid_token", error_description=`+strconv.Quote(err.Error()))
+			return
+		}
+
+		c.SetPrincipal(claims)
+		c.Next()
+	}
+}
+
+//Subject 获取sub声明
+func (claims JWTClaims) Subject() string {
+	s, _ := claims["sub"].(string)
+	return s
+}
+
+//Issuer 获取iss声明
+func (claims JWTClaims) Issuer() string {
+	s, _ := claims["iss"].(string)
+	return s
+}
+
+//Audience 获取aud声明，单个字符串时返回长度为1的数组
+func (claims JWTClaims) Audience() []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		res := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+//Time 获取时间类型的声明，如exp、nbf、iat，精确到秒
+//name 声明名称
+//return 时间、是否存在且为数字
+func (claims JWTClaims) Time(name string) (time.Time, bool) {
+	sec, has, err := claims.numericDate(name)
+	if !has || err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+//numericDate: 获取NumericDate类型的声明，小数部分截断，超出int64范围时取边界值
+//return 秒数、是否存在、不是数字时的错误
+func (claims JWTClaims) numericDate(name string) (int64, bool, error) {
+	v, has := claims[name]
+	if !has {
+		return 0, false, nil
+	}
+
+	var f float64
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case json.Number:
+		var err error
+		if f, err = x.Float64(); err != nil {
+			return 0, true, fmt.Errorf("token claim %q is not a number", name)
+		}
+	default:
+		return 0, true, fmt.Errorf("token claim %q is not a number", name)
+	}
+
+	switch {
+	case math.IsNaN(f):
+		return 0, true, fmt.Errorf("token claim %q is not a number", name)
+	case f >= math.MaxInt64:
+		return math.MaxInt64, true, nil
+	case f <= math.MinInt64:
+		return math.MinInt64, true, nil
+	}
+	return int64(f), true, nil
+}
+
+//verify: 校验令牌签名与声明
+func (v *jwtVerifier) verify(token string, c *Context) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errTokenMalformed
+	}
+	if !v.algorithms[header.Alg] {
+		return nil, fmt.Errorf("signing algorithm %q is not allowed", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errTokenMalformed
+	}
+	if err = v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims JWTClaims
+	if err = decodeSegment(parts[1], &claims); err != nil || claims == nil {
+		return nil, errTokenMalformed
+	}
+	if err = v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	if v.cfg.Validate != nil {
+		if err = v.cfg.Validate(claims, c); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+//verifySignature: 按算法校验签名
+func (v *jwtVerifier) verifySignature(alg, kid, signed string, sig []byte) error {
+	if alg == HS256 && len(v.cfg.Secret) > 0 {
+		mac := hmac.New(sha256.New, v.cfg.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errTokenSignature
+		}
+		return nil
+	}
+
+	key := v.key(kid)
+	if key == nil {
+		return fmt.Errorf("no key for kid %q", kid)
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != RS256 || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return errTokenSignature
+		}
+	case *ecdsa.PublicKey:
+		if alg != ES256 || k.Curve != elliptic.P256() || len(sig) != 64 {
+			return errTokenSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return errTokenSignature
+		}
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		if alg != HS256 || !hmac.Equal(sig, mac.Sum(nil)) {
+			return errTokenSignature
+		}
+	default:
+		return errTokenSignature
+	}
+	return nil
+}
+
+//validateClaims: 校验时间、签发者、受众与必需声明
+func (v *jwtVerifier) validateClaims(claims JWTClaims) error {
+	//按整秒比较，时钟偏差不足一秒时按一秒计
+	now := time.Now().Unix()
+	leeway := int64((v.cfg.Leeway + time.Second - 1) / time.Second)
+
+	exp, has, err := claims.numericDate("exp")
+	if err != nil {
+		return err
+	}
+	if has && now-leeway >= exp {
+		return errTokenExpired
+	}
+	for _, name := range []string{"nbf", "iat"} {
+		t, has, err := claims.numericDate(name)
+		if err != nil {
+			return err
+		}
+		if has && now+leeway < t {
+			return errTokenNotValid
+		}
+	}
+
+	if v.cfg.Issuer != "" && claims.Issuer() != v.cfg.Issuer {
+		return errors.New("token issuer is invalid")
+	}
+	if v.cfg.Audience != "" {
+		found := false
+		for _, aud := range claims.Audience() {
+			if aud == v.cfg.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("token audience is invalid")
+		}
+	}
+
+	for _, name := range v.cfg.RequiredClaims {
+		if _, has := claims[name]; !has {
+			return fmt.Errorf("token claim %q is required", name)
+		}
+	}
+	return nil
+}
+
+//key: 根据kid查找公钥，优先使用PublicKeys
+func (v *jwtVerifier) key(kid string) crypto.PublicKey {
+	if k, has := v.cfg.PublicKeys[kid]; has {
+		return k
+	}
+	if v.cfg.JWKSFile == "" {
+		return nil
+	}
+
+	v.lock.RLock()
+	stale := time.Since(v.checked) >= jwksCheckInterval
+	v.lock.RUnlock()
+	if stale {
+		v.loadJWKS()
+	}
+
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	if k, has := v.jwks[kid]; has {
+		return k
+	}
+	//只有一个未命名密钥时，令牌可不携带kid
+	if kid == "" && len(v.jwks) == 1 {
+		for _, k := range v.jwks {
+			return k
+		}
+	}
+	return nil
+}
+
+//loadJWKS: JWKS文件修改后重新加载
+func (v *jwtVerifier) loadJWKS() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.checked = time.Now()
+	info, err := os.Stat(v.cfg.JWKSFile)
+	if err != nil {
+		return err
+	}
+	if v.jwks != nil && info.ModTime().Equal(v.modTime) {
+		return nil
+	}
+
+	b, err := os.ReadFile(v.cfg.JWKSFile)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		k, err := jwk.publicKey()
+		if err != nil {
+			return fmt.Errorf("JWKS key %q: %s", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = k
+	}
+
+	v.jwks = keys
+	v.modTime = info.ModTime()
+	return nil
+}
+
+//publicKey: 将JWK转换为公钥
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+//decodeSegment: 解码base64url编码的JSON片段
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
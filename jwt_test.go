@@ -0,0 +1,216 @@
+package yun
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	testECDSAKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testHMACSecret  = []byte("0123456789abcdef0123456789abcdef")
+)
+
+//signTestToken: 生成测试令牌，key为[]byte、*rsa.PrivateKey或*ecdsa.PrivateKey
+func signTestToken(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var sig []byte
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+//jwtStatus: 以令牌请求使用JWT中间件的路由，返回状态码
+func jwtStatus(t *testing.T, mw HandlerFunc, token string) int {
+	t.Helper()
+	eng := New(RELEASE)
+	eng.Use(mw)
+	eng.Handle("/").Get(func(c *Context) {
+		if _, ok := c.Principal().(JWTClaims); !ok {
+			t.Error("expected JWTClaims as the principal")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest(GET, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, req)
+	return w.Code
+}
+
+//TestJWTAlgorithmConfusion 令牌不能通过更换alg使用其他类型的密钥校验
+func TestJWTAlgorithmConfusion(t *testing.T) {
+	pubDER, err := x509.MarshalPKIXPublicKey(&testRSAKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{"sub": "alice"}
+
+	rsaOnly := JWT(JWTConfig{PublicKeys: map[string]crypto.PublicKey{"": &testRSAKey.PublicKey}})
+	mixed := JWT(JWTConfig{
+		Algorithms: []string{HS256, RS256, ES256},
+		PublicKeys: map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey, "ec": &testECDSAKey.PublicKey},
+	})
+
+	tests := []struct {
+		name  string
+		mw    HandlerFunc
+		token string
+		want  int
+	}{
+		{"rs256 accepted", rsaOnly, signTestToken(t, map[string]interface{}{"alg": RS256}, claims, testRSAKey), http.StatusOK},
+		{"hs256 with public key not allowed", rsaOnly, signTestToken(t, map[string]interface{}{"alg": HS256}, claims, pubDER), http.StatusUnauthorized},
+		{"hs256 with public key on rsa kid", mixed, signTestToken(t, map[string]interface{}{"alg": HS256, "kid": "rsa"}, claims, pubDER), http.StatusUnauthorized},
+		{"none", rsaOnly, signTestToken(t, map[string]interface{}{"alg": "none"}, claims, nil), http.StatusUnauthorized},
+		{"es256 on rsa kid", mixed, signTestToken(t, map[string]interface{}{"alg": ES256, "kid": "rsa"}, claims, testECDSAKey), http.StatusUnauthorized},
+		{"rs256 on ec kid", mixed, signTestToken(t, map[string]interface{}{"alg": RS256, "kid": "ec"}, claims, testRSAKey), http.StatusUnauthorized},
+		{"es256 on ec kid", mixed, signTestToken(t, map[string]interface{}{"alg": ES256, "kid": "ec"}, claims, testECDSAKey), http.StatusOK},
+		{"unknown kid", mixed, signTestToken(t, map[string]interface{}{"alg": RS256, "kid": "other"}, claims, testRSAKey), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jwtStatus(t, tt.mw, tt.token); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+//TestJWTClaimsTime exp、nbf、iat须为数字，按整秒比较
+func TestJWTClaimsTime(t *testing.T) {
+	mw := JWT(JWTConfig{Secret: testHMACSecret, Leeway: 500 * time.Millisecond})
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   int
+	}{
+		{"valid", map[string]interface{}{"exp": now + 60, "nbf": now - 60, "iat": now}, http.StatusOK},
+		{"expired", map[string]interface{}{"exp": now - 60}, http.StatusUnauthorized},
+		{"expired within leeway", map[string]interface{}{"exp": now}, http.StatusOK},
+		{"huge exp", map[string]interface{}{"exp": 1e300}, http.StatusOK},
+		{"fractional exp", map[string]interface{}{"exp": float64(now) + 60.5}, http.StatusOK},
+		{"string exp", map[string]interface{}{"exp": "never"}, http.StatusUnauthorized},
+		{"null exp", map[string]interface{}{"exp": nil}, http.StatusUnauthorized},
+		{"not yet valid", map[string]interface{}{"nbf": now + 60}, http.StatusUnauthorized},
+		{"string nbf", map[string]interface{}{"nbf": "now"}, http.StatusUnauthorized},
+		{"issued in the future", map[string]interface{}{"iat": now + 60}, http.StatusUnauthorized},
+		{"boolean iat", map[string]interface{}{"iat": true}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signTestToken(t, map[string]interface{}{"alg": HS256}, tt.claims, testHMACSecret)
+			if got := jwtStatus(t, mw, token); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+//TestJWTJWKS 从JWKS文件按kid查找密钥，文件修改后重新加载
+func TestJWTJWKS(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS := func(keys ...jsonWebKey) {
+		t.Helper()
+		b, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		if err := os.WriteFile(file, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	rsaJWK := jsonWebKey{Kty: "RSA", Kid: "rsa", N: b64(testRSAKey.N.Bytes()), E: b64(big.NewInt(int64(testRSAKey.E)).Bytes())}
+	ecJWK := jsonWebKey{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64(testECDSAKey.X.Bytes()), Y: b64(testECDSAKey.Y.Bytes())}
+	octJWK := jsonWebKey{Kty: "oct", Kid: "oct", K: b64(testHMACSecret)}
+	writeJWKS(rsaJWK, ecJWK, octJWK)
+
+	cfg := JWTConfig{JWKSFile: file, Algorithms: []string{HS256, RS256, ES256}}
+	mw := JWT(cfg)
+	claims := map[string]interface{}{"sub": "alice"}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"rsa", signTestToken(t, map[string]interface{}{"alg": RS256, "kid": "rsa"}, claims, testRSAKey), http.StatusOK},
+		{"ec", signTestToken(t, map[string]interface{}{"alg": ES256, "kid": "ec"}, claims, testECDSAKey), http.StatusOK},
+		{"oct", signTestToken(t, map[string]interface{}{"alg": HS256, "kid": "oct"}, claims, testHMACSecret), http.StatusOK},
+		{"rs256 on oct kid", signTestToken(t, map[string]interface{}{"alg": RS256, "kid": "oct"}, claims, testRSAKey), http.StatusUnauthorized},
+		{"hs256 with public key on rsa kid", signTestToken(t, map[string]interface{}{"alg": HS256, "kid": "rsa"}, claims, testRSAKey.N.Bytes()), http.StatusUnauthorized},
+		{"missing kid with several keys", signTestToken(t, map[string]interface{}{"alg": RS256}, claims, testRSAKey), http.StatusUnauthorized},
+		{"wrong ec key", signTestToken(t, map[string]interface{}{"alg": ES256, "kid": "ec"}, claims, otherKey), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jwtStatus(t, mw, tt.token); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	//替换为单个密钥后，令牌可不携带kid
+	v := &jwtVerifier{cfg: cfg, algorithms: map[string]bool{ES256: true}}
+	if err = v.loadJWKS(); err != nil {
+		t.Fatal(err)
+	}
+	ecJWK.Kid = "rotated"
+	ecJWK.X, ecJWK.Y = b64(otherKey.X.Bytes()), b64(otherKey.Y.Bytes())
+	writeJWKS(ecJWK)
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(file, future, future); err != nil {
+		t.Fatal(err)
+	}
+	v.checked = time.Time{}
+
+	token := signTestToken(t, map[string]interface{}{"alg": ES256}, claims, otherKey)
+	if _, err = v.verify(token, nil); err != nil {
+		t.Fatalf("expected the reloaded key to verify, got %v", err)
+	}
+	token = signTestToken(t, map[string]interface{}{"alg": ES256, "kid": "ec"}, claims, testECDSAKey)
+	if _, err = v.verify(token, nil); err == nil {
+		t.Fatal("expected the removed key to be rejected")
+	}
+}
@@ -0,0 +1,115 @@
+package yun
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//listenFdsStart systemd传递的第一个文件描述符
+const listenFdsStart = 3
+
+//RunUnix 在Unix域套接字上运行http服务，收到SIGINT或SIGTERM时优雅关闭
+//path 套接字文件路径，已存在的套接字文件将被删除
+//mode 套接字文件权限
+//return 返回错误
+func (eng *Engine) RunUnix(path string, mode os.FileMode) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return errors.New("Unix socket path \"" + path + "\" exists and is not a socket")
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return err
+	}
+
+	eng.printDebugInfo("Listening and serving HTTP on unix:%s\n", path)
+	return eng.serve(signalContext(), ln, eng.newServer())
+}
+
+//RunListener 在指定的监听器上运行http服务，收到SIGINT或SIGTERM时优雅关闭
+//ln 监听器
+//return 返回错误
+func (eng *Engine) RunListener(ln net.Listener) error {
+	eng.printDebugInfo("Listening and serving HTTP on %s\n", ln.Addr())
+	return eng.serve(signalContext(), ln, eng.newServer())
+}
+
+//RunSystemd 在systemd套接字激活传递的全部监听器上运行http服务，收到SIGINT或SIGTERM时优雅关闭
+//return 返回错误
+func (eng *Engine) RunSystemd() error {
+	lns, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+	if len(lns) == 0 {
+		return errors.New("No sockets passed by systemd")
+	}
+
+	ctx := signalContext()
+	errs := make([]error, len(lns))
+	var wg sync.WaitGroup
+	for i := range lns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			eng.printDebugInfo("Listening and serving HTTP on %s\n", lns[i].Addr())
+			errs[i] = eng.serve(ctx, lns[i], eng.newServer())
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+//SystemdListeners 获取systemd套接字激活（LISTEN_FDS）传递的监听器
+//return 返回监听器，未被激活时为空、错误
+func SystemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	lns := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+
+	return lns, nil
+}
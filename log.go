@@ -1,7 +1,10 @@
 package yun
 
 import (
+	"fmt"
 	"io"
+	"log"
+	"os"
 )
 
 //ILogger 日志记录器接口
@@ -19,4 +22,144 @@ type ILogger interface {
 	Errorf(string, ...interface{})
 	Fatal(...interface{})
 	Fatalf(string, ...interface{})
-}
\ No newline at end of file
+}
+
+type (
+	//stdLogger 基于标准库log的日志记录器
+	stdLogger struct {
+		l *log.Logger
+	}
+
+	//prefixLogger 为每条日志添加固定前缀，如请求ID
+	prefixLogger struct {
+		ILogger
+		prefix string
+	}
+)
+
+//NewLogger 创建基于标准库log的日志记录器，每条日志带有时间与级别
+//w 日志输出，为nil时使用os.Stderr
+//return 日志记录器
+func NewLogger(w io.Writer) ILogger {
+	if w == nil {
+		w = os.Stderr
+	}
+	return &stdLogger{l: log.New(w, "", log.LstdFlags)}
+}
+
+//WithPrefix 创建为每条日志添加前缀的日志记录器
+//l 日志记录器
+//prefix 前缀，如"request_id=xxx"
+//return 日志记录器
+func WithPrefix(l ILogger, prefix string) ILogger {
+	if prefix == "" {
+		return l
+	}
+	return &prefixLogger{ILogger: l, prefix: prefix + " "}
+}
+
+func (l *stdLogger) output(level, s string) {
+	l.l.Output(3, level+s)
+}
+
+func (l *stdLogger) SetOutput(w io.Writer) {
+	l.l.SetOutput(w)
+}
+
+func (l *stdLogger) Print(v ...interface{}) {
+	l.output("", fmt.Sprint(v...))
+}
+
+func (l *stdLogger) Printf(format string, v ...interface{}) {
+	l.output("", fmt.Sprintf(format, v...))
+}
+
+func (l *stdLogger) Debug(v ...interface{}) {
+	l.output("[DEBUG] ", fmt.Sprint(v...))
+}
+
+func (l *stdLogger) Debugf(format string, v ...interface{}) {
+	l.output("[DEBUG] ", fmt.Sprintf(format, v...))
+}
+
+func (l *stdLogger) Info(v ...interface{}) {
+	l.output("[INFO] ", fmt.Sprint(v...))
+}
+
+func (l *stdLogger) Infof(format string, v ...interface{}) {
+	l.output("[INFO] ", fmt.Sprintf(format, v...))
+}
+
+func (l *stdLogger) Warn(v ...interface{}) {
+	l.output("[WARN] ", fmt.Sprint(v...))
+}
+
+func (l *stdLogger) Warnf(format string, v ...interface{}) {
+	l.output("[WARN] ", fmt.Sprintf(format, v...))
+}
+
+func (l *stdLogger) Error(v ...interface{}) {
+	l.output("[ERROR] ", fmt.Sprint(v...))
+}
+
+func (l *stdLogger) Errorf(format string, v ...interface{}) {
+	l.output("[ERROR] ", fmt.Sprintf(format, v...))
+}
+
+func (l *stdLogger) Fatal(v ...interface{}) {
+	l.output("[FATAL] ", fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+func (l *stdLogger) Fatalf(format string, v ...interface{}) {
+	l.output("[FATAL] ", fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+func (l *prefixLogger) Print(v ...interface{}) {
+	l.ILogger.Print(l.prefix + fmt.Sprint(v...))
+}
+
+func (l *prefixLogger) Printf(format string, v ...interface{}) {
+	l.ILogger.Print(l.prefix + fmt.Sprintf(format, v...))
+}
+
+func (l *prefixLogger) Debug(v ...interface{}) {
+	l.ILogger.Debug(l.prefix + fmt.Sprint(v...))
+}
+
+func (l *prefixLogger) Debugf(format string, v ...interface{}) {
+	l.ILogger.Debug(l.prefix + fmt.Sprintf(format, v...))
+}
+
+func (l *prefixLogger) Info(v ...interface{}) {
+	l.ILogger.Info(l.prefix + fmt.Sprint(v...))
+}
+
+func (l *prefixLogger) Infof(format string, v ...interface{}) {
+	l.ILogger.Info(l.prefix + fmt.Sprintf(format, v...))
+}
+
+func (l *prefixLogger) Warn(v ...interface{}) {
+	l.ILogger.Warn(l.prefix + fmt.Sprint(v...))
+}
+
+func (l *prefixLogger) Warnf(format string, v ...interface{}) {
+	l.ILogger.Warn(l.prefix + fmt.Sprintf(format, v...))
+}
+
+func (l *prefixLogger) Error(v ...interface{}) {
+	l.ILogger.Error(l.prefix + fmt.Sprint(v...))
+}
+
+func (l *prefixLogger) Errorf(format string, v ...interface{}) {
+	l.ILogger.Error(l.prefix + fmt.Sprintf(format, v...))
+}
+
+func (l *prefixLogger) Fatal(v ...interface{}) {
+	l.ILogger.Fatal(l.prefix + fmt.Sprint(v...))
+}
+
+func (l *prefixLogger) Fatalf(format string, v ...interface{}) {
+	l.ILogger.Fatal(l.prefix + fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,332 @@
+package yun
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	//ProxyConfig 反向代理配置
+	ProxyConfig struct {
+		//Targets 上游地址，如"http://10.0.0.1:8080"
+		Targets []string
+		//Balancer 负载均衡策略，为nil时使用RoundRobin
+		Balancer ProxyBalancer
+		//Retries 幂等且无请求体的请求在连接上游失败时改用其他上游重试的次数
+		Retries int
+		//FailThreshold 连续失败该次数后暂时摘除上游
+		FailThreshold int
+		//FailTimeout 上游被摘除的时长
+		FailTimeout time.Duration
+		//Rewrite 改写转发的路径，参数为去掉路由组前缀后的路径
+		Rewrite func(path string) string
+		//Transport 底层传输，为nil时使用http.DefaultTransport
+		Transport http.RoundTripper
+		//ModifyResponse 修改上游的响应
+		ModifyResponse func(*http.Response) error
+	}
+
+	//ProxyTarget 上游
+	ProxyTarget struct {
+		URL *url.URL
+
+		conns     int64
+		fails     int32
+		downUntil int64
+	}
+
+	//ProxyBalancer 负载均衡策略
+	ProxyBalancer interface {
+		//Next 从可用的上游中选择一个
+		Next(c *Context, targets []*ProxyTarget) *ProxyTarget
+	}
+
+	roundRobinBalancer struct {
+		n uint64
+	}
+
+	leastConnBalancer struct {
+		n uint64
+	}
+
+	hashBalancer struct {
+		key func(*Context) string
+	}
+
+	//modifyResponseError ModifyResponse返回的错误，上游已正常响应，不计为上游故障
+	modifyResponseError struct {
+		err error
+	}
+)
+
+//DefaultProxyConfig 默认的反向代理配置
+var DefaultProxyConfig = ProxyConfig{
+	FailThreshold: 3,
+	FailTimeout:   10 * time.Second,
+}
+
+//Proxy 反向代理，转发去掉路由组前缀后的路径，如组"/api"下的路由转发"/api/legacy"时上游路径为"/legacy"
+//设置X-Forwarded-For、X-Forwarded-Host、X-Forwarded-Proto，支持WebSocket
+//config 反向代理配置
+//return 处理函数
+func Proxy(config ProxyConfig) HandlerFunc {
+	if len(config.Targets) == 0 {
+		panic("Proxy requires at least one target")
+	}
+	if config.Balancer == nil {
+		config.Balancer = RoundRobin()
+	}
+	if config.FailThreshold <= 0 {
+		config.FailThreshold = DefaultProxyConfig.FailThreshold
+	}
+	if config.FailTimeout <= 0 {
+		config.FailTimeout = DefaultProxyConfig.FailTimeout
+	}
+
+	targets := make([]*ProxyTarget, len(config.Targets))
+	for i, t := range config.Targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			panic(err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			panic("Invalid proxy target: " + t)
+		}
+		targets[i] = &ProxyTarget{URL: u}
+	}
+
+	return func(c *Context) {
+		req := c.Request()
+		levels := c.engine.router.groupLevels[staticRouteKey{method: req.Method, path: c.FullPath()}]
+		upstreamPath := trimPathLevels(req.URL.Path, levels)
+		if config.Rewrite != nil {
+			upstreamPath = config.Rewrite(upstreamPath)
+		}
+
+		retries := config.Retries
+		if !isIdempotent(req.Method) || req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0 {
+			retries = 0
+		}
+
+		tried := make(map[*ProxyTarget]bool, retries+1)
+		var err error
+		for attempt := 0; attempt <= retries; attempt++ {
+			t := pickTarget(c, config.Balancer, targets, tried)
+			if t == nil {
+				break
+			}
+			tried[t] = true
+
+			err = config.forward(c, t, upstreamPath)
+			var me *modifyResponseError
+			if err == nil || errors.As(err, &me) {
+				t.success()
+				break
+			}
+			//客户端取消或请求超时不是上游的故障
+			if req.Context().Err() != nil {
+				break
+			}
+			t.failure(config.FailThreshold, config.FailTimeout)
+			if c.Written() {
+				break
+			}
+		}
+
+		if c.Written() {
+			return
+		}
+		if isTimeout(err) {
+			c.String(http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout))
+			return
+		}
+		c.String(http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+	}
+}
+
+//forward: 将请求转发到上游，返回连接上游的错误，ModifyResponse的错误以modifyResponseError返回
+func (cfg *ProxyConfig) forward(c *Context, t *ProxyTarget, upstreamPath string) error {
+	var (
+		proxyErr error
+		span     *Span
+	)
+	trusted := c.engine.isTrustedPeer(c.Request().RemoteAddr)
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = upstreamPath
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(t.URL)
+
+			//来自可信代理时保留已有的转发信息，否则丢弃客户端伪造的请求头
+			if trusted {
+				pr.Out.Header[HeaderXForwardedFor] = pr.In.Header[HeaderXForwardedFor]
+			}
+			pr.SetXForwarded()
+			if trusted {
+				for _, name := range []string{HeaderXForwardedHost, HeaderXForwardedProto} {
+					if v := pr.In.Header.Get(name); v != "" {
+						pr.Out.Header.Set(name, v)
+					}
+				}
+			}
+
+			//每次转发作为当前span的子调用
+			span = startClientSpan(c.Span(), pr.Out)
+		},
+		Transport: cfg.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			proxyErr = err
+		},
+	}
+	if cfg.ModifyResponse != nil {
+		rp.ModifyResponse = func(res *http.Response) error {
+			if err := cfg.ModifyResponse(res); err != nil {
+				return &modifyResponseError{err: err}
+			}
+			return nil
+		}
+	}
+
+	atomic.AddInt64(&t.conns, 1)
+	defer atomic.AddInt64(&t.conns, -1)
+
+	rp.ServeHTTP(c.Response(), c.Request())
+	span.endClientSpan(c.Status(), proxyErr)
+	return proxyErr
+}
+
+func (e *modifyResponseError) Error() string {
+	return "proxy: modify response: " + e.err.Error()
+}
+
+func (e *modifyResponseError) Unwrap() error {
+	return e.err
+}
+
+//Conns 正在处理的请求数
+func (t *ProxyTarget) Conns() int64 {
+	return atomic.LoadInt64(&t.conns)
+}
+
+//Healthy 是否未被摘除
+func (t *ProxyTarget) Healthy() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(&t.downUntil)
+}
+
+//success: 请求成功，清除失败计数
+func (t *ProxyTarget) success() {
+	atomic.StoreInt32(&t.fails, 0)
+}
+
+//failure: 请求失败，连续失败达到阈值时摘除
+func (t *ProxyTarget) failure(threshold int, timeout time.Duration) {
+	if atomic.AddInt32(&t.fails, 1) >= int32(threshold) {
+		atomic.StoreInt32(&t.fails, 0)
+		atomic.StoreInt64(&t.downUntil, time.Now().Add(timeout).UnixNano())
+	}
+}
+
+//RoundRobin 轮询
+func RoundRobin() ProxyBalancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) Next(c *Context, targets []*ProxyTarget) *ProxyTarget {
+	n := atomic.AddUint64(&b.n, 1)
+	return targets[(n-1)%uint64(len(targets))]
+}
+
+//LeastConnections 选择正在处理请求数最少的上游，数量相同时轮询
+func LeastConnections() ProxyBalancer {
+	return &leastConnBalancer{}
+}
+
+func (b *leastConnBalancer) Next(c *Context, targets []*ProxyTarget) *ProxyTarget {
+	start := int(atomic.AddUint64(&b.n, 1) % uint64(len(targets)))
+	best := targets[start]
+	for i := 1; i < len(targets); i++ {
+		t := targets[(start+i)%len(targets)]
+		if t.Conns() < best.Conns() {
+			best = t
+		}
+	}
+	return best
+}
+
+//ConsistentHash 一致性哈希（最高随机权重），相同的键始终转发到同一上游，上游增减时只影响部分键
+//key 哈希的键，为nil时使用客户端IP
+func ConsistentHash(key func(*Context) string) ProxyBalancer {
+	if key == nil {
+		key = KeyByIP
+	}
+	return &hashBalancer{key: key}
+}
+
+func (b *hashBalancer) Next(c *Context, targets []*ProxyTarget) *ProxyTarget {
+	key := b.key(c)
+
+	var (
+		best  *ProxyTarget
+		score uint64
+	)
+	for _, t := range targets {
+		h := fnv.New64a()
+		h.Write([]byte(t.URL.String()))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		if s := h.Sum64(); best == nil || s > score {
+			best, score = t, s
+		}
+	}
+	return best
+}
+
+//pickTarget: 在未尝试的健康上游中选择，全部摘除时仍在未尝试的上游中选择
+func pickTarget(c *Context, b ProxyBalancer, targets []*ProxyTarget, tried map[*ProxyTarget]bool) *ProxyTarget {
+	healthy := make([]*ProxyTarget, 0, len(targets))
+	rest := make([]*ProxyTarget, 0, len(targets))
+	for _, t := range targets {
+		if tried[t] {
+			continue
+		}
+		if t.Healthy() {
+			healthy = append(healthy, t)
+		} else {
+			rest = append(rest, t)
+		}
+	}
+
+	if len(healthy) > 0 {
+		return b.Next(c, healthy)
+	}
+	if len(rest) > 0 {
+		return b.Next(c, rest)
+	}
+	return nil
+}
+
+//trimPathLevels: 去掉路径的前n级，组路径可含参数，因此按级数而非按字符串去除
+func trimPathLevels(p string, n int) string {
+	for ; n > 0; n-- {
+		i := strings.IndexByte(p[1:], '/')
+		if i < 0 {
+			return "/"
+		}
+		p = p[i+1:]
+	}
+	return p
+}
+
+//isTimeout: 是否为超时错误
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,257 @@
+package yun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//proxyHeaderTimeout 读取PROXY协议头的超时时间
+const proxyHeaderTimeout = 5 * time.Second
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errProxyHeader    = errors.New("invalid PROXY protocol header")
+	errProxyMissing   = errors.New("missing PROXY protocol header")
+	errProxyUntrusted = errors.New("connection not from a trusted PROXY protocol upstream")
+)
+
+type (
+	//ProxyProtocolConfig PROXY协议配置
+	ProxyProtocolConfig struct {
+		//TrustedUpstreams 允许发送PROXY协议头的负载均衡地址段，只解析来自这些地址的协议头
+		TrustedUpstreams []netip.Prefix
+		//Required 是否要求全部连接经由负载均衡：拒绝其他地址的连接，以及未携带协议头的连接
+		Required bool
+	}
+
+	//proxyListener 解析PROXY协议头的监听器
+	proxyListener struct {
+		net.Listener
+		cfg     ProxyProtocolConfig
+		timeout time.Duration
+	}
+
+	//proxyConn 首次读取或获取地址时解析PROXY协议头的连接
+	proxyConn struct {
+		net.Conn
+		br       *bufio.Reader
+		timeout  time.Duration
+		trusted  bool
+		required bool
+		once     sync.Once
+		remote   net.Addr
+		local    net.Addr
+		err      error
+	}
+)
+
+//ProxyProtocolListener 包装监听器，解析负载均衡发送的PROXY协议头（v1/v2）以获取真实的客户端地址
+//只信任来自TrustedUpstreams的协议头，其他地址的连接不解析协议头，未要求Required时按原样处理
+//ln 监听器
+//config PROXY协议配置
+//return 包装后的监听器
+func ProxyProtocolListener(ln net.Listener, config ProxyProtocolConfig) net.Listener {
+	return &proxyListener{Listener: ln, cfg: config, timeout: proxyHeaderTimeout}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:     conn,
+		br:       bufio.NewReader(conn),
+		timeout:  l.timeout,
+		trusted:  l.isTrusted(conn.RemoteAddr()),
+		required: l.cfg.Required,
+	}, nil
+}
+
+//isTrusted: 对端是否属于TrustedUpstreams
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.AddrPort().Addr()
+	default:
+		ap, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return false
+		}
+		ip = ap.Addr()
+	}
+
+	ip = ip.Unmap()
+	for _, prefix := range l.cfg.TrustedUpstreams {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+//init: 解析可信对端的PROXY协议头，要求协议头时拒绝其他连接
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		if !c.trusted {
+			if c.required {
+				c.err = errProxyUntrusted
+			}
+			return
+		}
+
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		b, err := c.br.Peek(1)
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		switch {
+		case b[0] == proxyV1Prefix[0] && c.hasPrefix(proxyV1Prefix):
+			c.remote, c.local, c.err = readProxyV1(c.br)
+		case b[0] == proxyV2Signature[0] && c.hasPrefix(proxyV2Signature):
+			c.remote, c.local, c.err = readProxyV2(c.br)
+		case c.required:
+			c.err = errProxyMissing
+		}
+	})
+}
+
+//hasPrefix: 连接的数据是否以prefix开头
+func (c *proxyConn) hasPrefix(prefix []byte) bool {
+	b, _ := c.br.Peek(len(prefix))
+	return bytes.Equal(b, prefix)
+}
+
+//readProxyV1: 解析文本格式的协议头，如 PROXY TCP4 192.0.2.1 192.0.2.2 56324 443
+func readProxyV1(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < 107 {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, nil, errProxyHeader
+	}
+
+	src, err := proxyTCPAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := proxyTCPAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+//readProxyV2: 解析二进制格式的协议头
+func readProxyV2(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var h [16]byte
+	if _, err := io.ReadFull(br, h[:]); err != nil {
+		return nil, nil, err
+	}
+	//版本须为2，命令只能为LOCAL（0）或PROXY（1）
+	if h[12]>>4 != 2 || h[12]&0x0f > 1 {
+		return nil, nil, errProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(h[14:]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, nil, err
+	}
+
+	//LOCAL命令为负载均衡自身的连接（如健康检查），保留原地址
+	if h[12]&0x0f == 0 {
+		return nil, nil, nil
+	}
+
+	//AF_UNSPEC保留原地址，其他地址族只接受STREAM传输
+	family, transport := h[13]>>4, h[13]&0x0f
+	if family == 0 {
+		return nil, nil, nil
+	}
+	if family > 3 || transport != 1 {
+		return nil, nil, errProxyHeader
+	}
+
+	switch family {
+	case 1:
+		if len(payload) < 12 {
+			return nil, nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))},
+			&net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:]))}, nil
+	case 2:
+		if len(payload) < 36 {
+			return nil, nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))},
+			&net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:]))}, nil
+	}
+
+	//Unix地址族，保留原地址
+	return nil, nil, nil
+}
+
+func proxyTCPAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if addr == nil || err != nil {
+		return nil, errProxyHeader
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
@@ -0,0 +1,178 @@
+package yun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+//proxyV2Header: 生成v2协议头
+func proxyV2Header(command, family byte, payload []byte) []byte {
+	b := append([]byte(nil), proxyV2Signature...)
+	b = append(b, 0x20|command, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	return append(b, payload...)
+}
+
+//proxyV2IPv4: 生成IPv4地址的v2载荷
+func proxyV2IPv4(src, dst string, srcPort, dstPort uint16) []byte {
+	b := append(net.ParseIP(src).To4(), net.ParseIP(dst).To4()...)
+	b = binary.BigEndian.AppendUint16(b, srcPort)
+	return binary.BigEndian.AppendUint16(b, dstPort)
+}
+
+//TestReadProxyV1 解析文本格式的协议头
+func TestReadProxyV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		remote  string
+		wantErr bool
+	}{
+		{"tcp4", "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", "192.0.2.1:56324", false},
+		{"tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", false},
+		{"unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"unknown with addresses", "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n", "", false},
+		{"missing crlf", "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\n", "", true},
+		{"truncated", "PROXY TCP4 192.0.2.1 192.0", "", true},
+		{"oversized", "PROXY TCP6 " + strings.Repeat("f", 100) + "\r\n", "", true},
+		{"unsupported protocol", "PROXY UDP4 192.0.2.1 192.0.2.2 56324 443\r\n", "", true},
+		{"missing port", "PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n", "", true},
+		{"invalid address", "PROXY TCP4 192.0.2.300 192.0.2.2 56324 443\r\n", "", true},
+		{"invalid port", "PROXY TCP4 192.0.2.1 192.0.2.2 65536 443\r\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, _, err := readProxyV1(bufio.NewReader(strings.NewReader(tt.header)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := addrString(remote); got != tt.remote {
+				t.Fatalf("expected remote %q, got %q", tt.remote, got)
+			}
+		})
+	}
+}
+
+//TestReadProxyV2 解析二进制格式的协议头
+func TestReadProxyV2(t *testing.T) {
+	ipv4 := proxyV2IPv4("192.0.2.1", "192.0.2.2", 56324, 443)
+	ipv6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0xdc, 0x04, 0x01, 0xbb)
+
+	tests := []struct {
+		name    string
+		header  []byte
+		remote  string
+		wantErr bool
+	}{
+		{"tcp4", proxyV2Header(1, 0x11, ipv4), "192.0.2.1:56324", false},
+		{"tcp6", proxyV2Header(1, 0x21, ipv6), "[2001:db8::1]:56324", false},
+		{"tcp4 with tlvs", proxyV2Header(1, 0x11, append(ipv4, 0x04, 0x00, 0x01, 0x00)), "192.0.2.1:56324", false},
+		{"local", proxyV2Header(0, 0x00, nil), "", false},
+		{"local ignores addresses", proxyV2Header(0, 0x11, ipv4), "", false},
+		{"unspec", proxyV2Header(1, 0x00, nil), "", false},
+		{"unix stream", proxyV2Header(1, 0x31, make([]byte, 216)), "", false},
+		{"invalid command", proxyV2Header(2, 0x11, ipv4), "", true},
+		{"invalid version", append(append([]byte(nil), proxyV2Signature...), 0x11, 0x11, 0x00, 0x0c), "", true},
+		{"udp", proxyV2Header(1, 0x12, ipv4), "", true},
+		{"unknown family", proxyV2Header(1, 0x41, ipv4), "", true},
+		{"short tcp4 payload", proxyV2Header(1, 0x11, ipv4[:8]), "", true},
+		{"short tcp6 payload", proxyV2Header(1, 0x21, ipv4), "", true},
+		{"truncated header", proxyV2Header(1, 0x11, ipv4)[:14], "", true},
+		{"truncated payload", proxyV2Header(1, 0x11, ipv4)[:20], "", true},
+		{"oversized length", append(proxyV2Header(1, 0x11, nil)[:14], 0xff, 0xff), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, _, err := readProxyV2(bufio.NewReader(bytes.NewReader(tt.header)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := addrString(remote); got != tt.remote {
+				t.Fatalf("expected remote %q, got %q", tt.remote, got)
+			}
+		})
+	}
+}
+
+//TestProxyProtocolListener 只解析可信对端的协议头，Required时拒绝缺少协议头的连接
+func TestProxyProtocolListener(t *testing.T) {
+	loopback := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	tests := []struct {
+		name     string
+		config   ProxyProtocolConfig
+		data     string
+		remote   string
+		readErr  bool
+		readData string
+	}{
+		{"trusted v1", ProxyProtocolConfig{TrustedUpstreams: loopback}, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nhello", "192.0.2.1:56324", false, "hello"},
+		{"trusted without header", ProxyProtocolConfig{TrustedUpstreams: loopback}, "hello", "", false, "hello"},
+		{"trusted without header required", ProxyProtocolConfig{TrustedUpstreams: loopback, Required: true}, "hello", "", true, ""},
+		{"untrusted header kept as data", ProxyProtocolConfig{}, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", "", false, "PROXY"},
+		{"untrusted required", ProxyProtocolConfig{Required: true}, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", "", true, ""},
+		{"trusted invalid header", ProxyProtocolConfig{TrustedUpstreams: loopback}, "PROXY TCP4 nope\r\nhello", "", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			pl := ProxyProtocolListener(ln, tt.config)
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			if _, err = io.WriteString(client, tt.data); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if tt.readErr {
+				if _, err = conn.Read(make([]byte, 1)); err == nil {
+					t.Fatal("expected a read error")
+				}
+				return
+			}
+			b := make([]byte, len(tt.readData))
+			if _, err = io.ReadFull(conn, b); err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.readData {
+				t.Fatalf("expected data %q, got %q", tt.readData, b)
+			}
+
+			want := tt.remote
+			if want == "" {
+				want = client.LocalAddr().String()
+			}
+			if got := conn.RemoteAddr().String(); got != want {
+				t.Fatalf("expected remote %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+//addrString: 地址的字符串形式，nil时为空
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
@@ -0,0 +1,300 @@
+package yun
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 限流算法
+const (
+	//TokenBucket 令牌桶，允许Burst以内的突发
+	TokenBucket RateLimitAlgorithm = iota
+	//SlidingWindow 滑动窗口计数
+	SlidingWindow
+)
+
+const (
+	defaultRateLimitShards = 32
+	//rateLimitSweepEvery 每个分片每处理若干次请求清理一次过期记录
+	rateLimitSweepEvery = 1024
+)
+
+//rateLimitSeq 限流中间件实例序号，用于隔离共享存储中的键
+var rateLimitSeq uint32
+
+type (
+	//RateLimitAlgorithm 限流算法
+	RateLimitAlgorithm int
+
+	//RateLimitRule 限流规则
+	RateLimitRule struct {
+		Algorithm RateLimitAlgorithm
+		//Limit 每个窗口允许的请求数
+		Limit int
+		//Window 窗口时长
+		Window time.Duration
+		//Burst 令牌桶容量，为0时等于Limit
+		Burst int
+	}
+
+	//RateLimitResult 限流判定结果
+	RateLimitResult struct {
+		Allowed    bool
+		Limit      int
+		Remaining  int
+		Reset      time.Duration
+		RetryAfter time.Duration
+	}
+
+	//RateLimitStore 限流状态存储，外部实现（如Redis）须保证判定的原子性
+	RateLimitStore interface {
+		Allow(key string, rule RateLimitRule) (RateLimitResult, error)
+	}
+
+	//RateLimitConfig 限流配置
+	RateLimitConfig struct {
+		RateLimitRule
+
+		//KeyFunc 限流的键，为nil时使用KeyByIP
+		KeyFunc func(*Context) string
+		//Store 状态存储，为nil时使用独立的内存存储
+		Store RateLimitStore
+		//Prefix 存储键的前缀，为空时自动生成，多个中间件共享存储时用于区分规则
+		Prefix string
+		//Skipper 返回true时跳过限流
+		Skipper func(*Context) bool
+		//ErrorHandler 超出限制时执行，为nil时响应429
+		ErrorHandler HandlerFunc
+	}
+
+	//MemoryRateLimitStore 分片的内存限流存储
+	MemoryRateLimitStore struct {
+		shards []*rateLimitShard
+	}
+
+	rateLimitShard struct {
+		lock    sync.Mutex
+		entries map[string]*rateLimitEntry
+		ops     int
+	}
+
+	rateLimitEntry struct {
+		//令牌桶：剩余令牌与上次填充时间
+		tokens float64
+		last   time.Time
+		//滑动窗口：当前窗口起点、当前与上一窗口的计数
+		start time.Time
+		cur   int
+		prev  int
+
+		expire time.Time
+	}
+)
+
+//RateLimit 限流中间件，可为不同路由组设置不同的规则
+//config 限流配置
+//return 中间件
+func RateLimit(config RateLimitConfig) HandlerFunc {
+	if config.Limit <= 0 || config.Window <= 0 {
+		panic("RateLimit requires a positive Limit and Window")
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = KeyByIP
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore(defaultRateLimitShards)
+	}
+	if config.Prefix == "" {
+		config.Prefix = "rl" + strconv.FormatUint(uint64(atomic.AddUint32(&rateLimitSeq, 1)), 10) + ":"
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context) {
+			c.String(http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+		}
+	}
+
+	return func(c *Context) {
+		if config.Skipper != nil && config.Skipper(c) {
+			c.Next()
+			return
+		}
+
+		res, err := config.Store.Allow(config.Prefix+config.KeyFunc(c), config.RateLimitRule)
+		if err != nil {
+			//存储不可用时放行
+			c.engine.printError(err)
+			c.Next()
+			return
+		}
+
+		h := c.Response().Header()
+		h.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+		h.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+		h.Set(HeaderRateLimitReset, ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			h.Set(HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+			config.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+//KeyByIP 以客户端IP作为限流的键
+func KeyByIP(c *Context) string {
+	return c.ClientIP()
+}
+
+//KeyByPrincipal 以认证主体作为限流的键，未认证时使用客户端IP
+func KeyByPrincipal(c *Context) string {
+	switch p := c.Principal().(type) {
+	case nil:
+		return "ip:" + c.ClientIP()
+	case JWTClaims:
+		return "sub:" + p.Subject()
+	case string:
+		return "user:" + p
+	default:
+		return "user:" + fmt.Sprint(p)
+	}
+}
+
+//NewMemoryRateLimitStore 创建内存限流存储
+//shards 分片数
+//return 内存存储
+func NewMemoryRateLimitStore(shards int) *MemoryRateLimitStore {
+	if shards <= 0 {
+		shards = defaultRateLimitShards
+	}
+
+	s := &MemoryRateLimitStore{shards: make([]*rateLimitShard, shards)}
+	for i := range s.shards {
+		s.shards[i] = &rateLimitShard{entries: make(map[string]*rateLimitEntry)}
+	}
+	return s
+}
+
+//Allow 判定请求是否允许通过
+func (s *MemoryRateLimitStore) Allow(key string, rule RateLimitRule) (RateLimitResult, error) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := s.shards[h.Sum32()%uint32(len(s.shards))]
+
+	now := time.Now()
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	if shard.ops++; shard.ops >= rateLimitSweepEvery {
+		shard.ops = 0
+		for k, e := range shard.entries {
+			if now.After(e.expire) {
+				delete(shard.entries, k)
+			}
+		}
+	}
+
+	e, has := shard.entries[key]
+	if !has {
+		e = &rateLimitEntry{last: now, start: now, tokens: float64(rule.capacity())}
+		shard.entries[key] = e
+	}
+	e.expire = now.Add(rule.ttl())
+
+	if rule.Algorithm == SlidingWindow {
+		return e.slidingWindow(now, rule), nil
+	}
+	return e.tokenBucket(now, rule), nil
+}
+
+//capacity: 令牌桶容量
+func (rule RateLimitRule) capacity() int {
+	if rule.Burst > 0 {
+		return rule.Burst
+	}
+	return rule.Limit
+}
+
+//ttl: 空闲记录的保留时间，不短于两个窗口（滑动窗口需要上一窗口的计数）及令牌桶从空到满的时间
+func (rule RateLimitRule) ttl() time.Duration {
+	ttl := 2 * rule.Window
+	if refill := time.Duration(float64(rule.Window) * float64(rule.capacity()) / float64(rule.Limit)); refill > ttl {
+		ttl = refill
+	}
+	return ttl
+}
+
+//tokenBucket: 令牌桶判定
+func (e *rateLimitEntry) tokenBucket(now time.Time, rule RateLimitRule) RateLimitResult {
+	capacity := float64(rule.capacity())
+	rate := float64(rule.Limit) / float64(rule.Window)
+
+	e.tokens = math.Min(capacity, e.tokens+float64(now.Sub(e.last))*rate)
+	e.last = now
+
+	res := RateLimitResult{Limit: rule.capacity()}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - e.tokens) / rate)
+	}
+
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration((capacity - e.tokens) / rate)
+	return res
+}
+
+//slidingWindow: 滑动窗口判定，按上一窗口剩余时间的比例加权估算当前计数
+func (e *rateLimitEntry) slidingWindow(now time.Time, rule RateLimitRule) RateLimitResult {
+	w := rule.Window
+	if elapsed := now.Sub(e.start); elapsed >= w {
+		if elapsed < 2*w {
+			e.prev = e.cur
+		} else {
+			e.prev = 0
+		}
+		e.cur = 0
+		e.start = e.start.Add(elapsed / w * w)
+	}
+
+	elapsed := now.Sub(e.start)
+	weight := float64(w-elapsed) / float64(w)
+	count := float64(e.prev)*weight + float64(e.cur)
+
+	res := RateLimitResult{Limit: rule.Limit, Reset: w - elapsed}
+	if count+1 <= float64(rule.Limit) {
+		e.cur++
+		count++
+		res.Allowed = true
+	} else if e.prev > 0 && e.cur < rule.Limit {
+		//等待上一窗口的权重下降到足以容纳一个请求
+		at := float64(w) - float64(rule.Limit-1-e.cur)*float64(w)/float64(e.prev)
+		res.RetryAfter = time.Duration(at) - elapsed
+	} else {
+		res.RetryAfter = w - elapsed
+	}
+
+	res.Remaining = rule.Limit - int(math.Ceil(count))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return res
+}
+
+//ceilSeconds: 向上取整的秒数
+func ceilSeconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,276 @@
+package yun
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	//htmlRender HTML模板渲染器
+	htmlRender struct {
+		lock      sync.RWMutex
+		fsys      fs.FS
+		patterns  []string
+		funcMap   template.FuncMap
+		templates map[string]*template.Template
+		modTimes  map[string]time.Time
+	}
+)
+
+//extendsRegexp 匹配模板首行的布局继承声明，如 {{/* extends "layouts/base.html" */}}
+var extendsRegexp = regexp.MustCompile(`^\s*\{\{-?\s*/\*\s*extends\s+"([^"]+)"\s*\*/\s*-?\}\}`)
+
+//SetFuncMap 设置模板函数，须在加载模板之前调用
+//funcMap 模板函数
+func (eng *Engine) SetFuncMap(funcMap template.FuncMap) {
+	eng.funcMap = funcMap
+}
+
+//LoadHTMLGlob 从磁盘加载HTML模板
+//pattern 模板文件的匹配模式，如 templates/*/*.html，模板名称为相对于模式中固定目录的路径
+//return 返回错误
+func (eng *Engine) LoadHTMLGlob(pattern string) error {
+	root, rest := splitGlob(filepath.ToSlash(pattern))
+	return eng.LoadHTMLFS(os.DirFS(root), rest)
+}
+
+//LoadHTMLFS 从文件系统加载HTML模板
+//fsys 文件系统，如embed.FS
+//patterns 模板文件的匹配模式，模板名称为文件在fsys中的路径
+//return 返回错误
+func (eng *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) error {
+	funcMap := template.FuncMap{
+		"url": eng.URL,
+	}
+	for k, v := range eng.funcMap {
+		funcMap[k] = v
+	}
+
+	r := &htmlRender{
+		fsys:     fsys,
+		patterns: patterns,
+		funcMap:  funcMap,
+	}
+	if err := r.load(); err != nil {
+		return err
+	}
+
+	eng.htmlRender = r
+	return nil
+}
+
+//Render 使用已加载的HTML模板响应
+//code 响应状态码
+//name 模板名称
+//data 模板数据，为nil或map[string]interface{}时将合并Context中保存的值
+//return 返回错误
+func (c *Context) Render(code int, name string, data interface{}) (err error) {
+	r := c.engine.htmlRender
+	if r == nil {
+		return errors.New("HTML templates are not loaded")
+	}
+
+	if c.engine.IsDebugging() {
+		if err = r.reload(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = r.execute(&buf, name, c.renderData(data)); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(HeaderContentType, MIMETextHTMLCharsetUTF8)
+	c.WriteHeader(code)
+	_, err = c.Write(buf.Bytes())
+	return
+}
+
+//renderData: 合并请求内保存的值与模板数据
+func (c *Context) renderData(data interface{}) interface{} {
+	switch d := data.(type) {
+	case nil:
+		merged := make(map[string]interface{}, len(c.keys))
+		for k, v := range c.keys {
+			merged[k] = v
+		}
+		return merged
+	case map[string]interface{}:
+		merged := make(map[string]interface{}, len(c.keys)+len(d))
+		for k, v := range c.keys {
+			merged[k] = v
+		}
+		for k, v := range d {
+			merged[k] = v
+		}
+		return merged
+	}
+	return data
+}
+
+func (r *htmlRender) execute(buf *bytes.Buffer, name string, data interface{}) error {
+	r.lock.RLock()
+	t, has := r.templates[name]
+	r.lock.RUnlock()
+	if !has {
+		return fmt.Errorf("HTML template %q does not exist", name)
+	}
+
+	return t.Execute(buf, data)
+}
+
+//reload: 模板文件发生变化时重新解析
+func (r *htmlRender) reload() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	changed := len(modTimes) != len(r.modTimes)
+	for name, t := range modTimes {
+		if changed {
+			break
+		}
+		if old, has := r.modTimes[name]; !has || !old.Equal(t) {
+			changed = true
+		}
+	}
+	r.lock.RUnlock()
+
+	if !changed {
+		return nil
+	}
+	return r.load()
+}
+
+//stat: 获取全部模板文件的修改时间
+func (r *htmlRender) stat() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, pattern := range r.patterns {
+		names, err := fs.Glob(r.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			info, err := fs.Stat(r.fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				modTimes[name] = info.ModTime()
+			}
+		}
+	}
+	return modTimes, nil
+}
+
+//load: 解析全部模板
+//以"_"开头的文件为局部模板，可被任意模板引用；
+//首行声明 {{/* extends "name" */}} 的模板继承指定布局，并以define覆盖布局中的block
+func (r *htmlRender) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(modTimes))
+	sources := make(map[string]string, len(modTimes))
+	for name := range modTimes {
+		b, err := fs.ReadFile(r.fsys, name)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		sources[name] = string(b)
+	}
+	sort.Strings(names)
+
+	var partials []string
+	for _, name := range names {
+		if strings.HasPrefix(path.Base(name), "_") {
+			partials = append(partials, name)
+		}
+	}
+
+	templates := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		chain, err := layoutChain(name, sources)
+		if err != nil {
+			return err
+		}
+
+		t := template.New("").Funcs(r.funcMap)
+		for _, p := range partials {
+			if _, err = t.New(p).Parse(sources[p]); err != nil {
+				return err
+			}
+		}
+		for _, n := range chain {
+			if _, err = t.New(n).Parse(sources[n]); err != nil {
+				return err
+			}
+		}
+		templates[name] = t.Lookup(chain[0])
+	}
+
+	r.lock.Lock()
+	r.templates = templates
+	r.modTimes = modTimes
+	r.lock.Unlock()
+
+	return nil
+}
+
+//layoutChain: 获取模板的继承链，从最外层布局到模板本身
+func layoutChain(name string, sources map[string]string) ([]string, error) {
+	chain := []string{name}
+	for cur := name; ; {
+		m := extendsRegexp.FindStringSubmatch(sources[cur])
+		if m == nil {
+			return chain, nil
+		}
+
+		parent := m[1]
+		if _, has := sources[parent]; !has {
+			return nil, fmt.Errorf("HTML template %q extends unknown layout %q", cur, parent)
+		}
+		for _, n := range chain {
+			if n == parent {
+				return nil, fmt.Errorf("HTML template %q has a circular layout", name)
+			}
+		}
+
+		chain = append([]string{parent}, chain...)
+		cur = parent
+	}
+}
+
+//splitGlob: 将匹配模式拆分为固定目录与剩余模式
+func splitGlob(pattern string) (string, string) {
+	segs := strings.Split(pattern, "/")
+	i := 0
+	for ; i < len(segs)-1; i++ {
+		if strings.ContainsAny(segs[i], `*?[\`) {
+			break
+		}
+	}
+
+	root := strings.Join(segs[:i], "/")
+	if root == "" {
+		root = "."
+	}
+	return root, strings.Join(segs[i:], "/")
+}
@@ -0,0 +1,149 @@
+package yun
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+//maxRequestIDLength 沿用客户端请求ID的最大长度
+const maxRequestIDLength = 128
+
+//crockford ULID使用的Crockford Base32字符表
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+//requestIDKey 请求ID在context.Context中保存的键
+type requestIDKey struct{}
+
+//RequestIDConfig 请求ID配置
+type RequestIDConfig struct {
+	//Header 读取与写入请求ID的请求头、响应头
+	Header string
+	//Generator 生成请求ID，可选UUIDv4、ULID
+	Generator func() string
+	//Skipper 返回true时跳过
+	Skipper func(*Context) bool
+}
+
+//DefaultRequestIDConfig 默认的请求ID配置
+var DefaultRequestIDConfig = RequestIDConfig{
+	Header:    HeaderXRequestID,
+	Generator: UUIDv4,
+}
+
+//RequestID 请求ID中间件，沿用请求头中合法的ID，否则生成新ID，并写入响应头
+//ID同时写回请求头，经Context.Send、Proxy转发到上游，使用自定义请求头时须加入Client.ForwardHeaders
+//config 请求ID配置，为空时使用DefaultRequestIDConfig
+//return 中间件
+func RequestID(config ...RequestIDConfig) HandlerFunc {
+	cfg := DefaultRequestIDConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultRequestIDConfig.Header
+	}
+	if cfg.Generator == nil {
+		cfg.Generator = DefaultRequestIDConfig.Generator
+	}
+
+	return func(c *Context) {
+		if cfg.Skipper != nil && cfg.Skipper(c) {
+			c.Next()
+			return
+		}
+
+		req := c.Request()
+		id := req.Header.Get(cfg.Header)
+		if !validRequestID(id) {
+			id = cfg.Generator()
+			req.Header.Set(cfg.Header, id)
+		}
+
+		c.WithValue(requestIDKey{}, id)
+		c.Response().Header().Set(cfg.Header, id)
+		c.Next()
+	}
+}
+
+//RequestID 获取当前请求的ID
+//return 请求ID，未使用RequestID中间件时为空
+func (c *Context) RequestID() string {
+	id, _ := c.requestContext().Value(requestIDKey{}).(string)
+	return id
+}
+
+//Logger 获取当前请求的日志记录器，每条日志带有请求ID
+//return 日志记录器
+func (c *Context) Logger() ILogger {
+	l := c.engine.Logger
+	if l == nil {
+		l = NewLogger(nil)
+	}
+	if id := c.RequestID(); id != "" {
+		return WithPrefix(l, "request_id="+id)
+	}
+	return l
+}
+
+//UUIDv4 生成随机的UUID（版本4）
+//return 如"0f8fad5b-d9cb-469f-a165-70867728950e"
+func UUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+//ULID 生成ULID，48位毫秒时间戳加80位随机数，按时间有序
+//return 26位Crockford Base32字符串，如"01ARZ3NDEKTSV4RRFFQ69G5FAV"
+func ULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	rand.Read(b[6:])
+
+	//128位按5位一组编码，首字符只有3位
+	var s [26]byte
+	var acc uint64
+	bits := 2
+	j := 0
+	for _, v := range b {
+		acc = acc<<8 | uint64(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			s[j] = crockford[acc>>uint(bits)&0x1f]
+			j++
+		}
+	}
+	return string(s[:])
+}
+
+//validRequestID: 请求头中的ID是否可沿用，仅允许有限长度的可打印ASCII字符以防日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
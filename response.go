@@ -2,6 +2,7 @@ package yun
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"net"
 	"net/http"
@@ -18,6 +19,7 @@ type (
 		http.Hijacker
 		http.Flusher
 		http.CloseNotifier
+		http.Pusher
 
 		//获取当前请求的响应状态码
 		Status() int
@@ -34,6 +36,14 @@ type (
 		status int
 		size   int
 	}
+
+	// 缓冲全部响应，由调用方决定何时写出
+	bufferWriter struct {
+		header      http.Header
+		status      int
+		wroteHeader bool
+		body        bytes.Buffer
+	}
 )
 
 func (w *responseWriter) reset(wr http.ResponseWriter) {
@@ -87,12 +97,100 @@ func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return hijacker.Hijack()
 }
 
-// 实现http.CloseNotify接口
+// 实现http.CloseNotify接口，底层不支持时返回永不触发的通道
 func (w *responseWriter) CloseNotify() <-chan bool {
-	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return make(chan bool)
 }
 
-// 实现http.Flush接口
+// 实现http.Flush接口，底层不支持时忽略
 func (w *responseWriter) Flush() {
-	w.ResponseWriter.(http.Flusher).Flush()
+	w.writeHeader()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 实现http.Pusher接口，底层不支持时返回http.ErrNotSupported
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// 供http.ResponseController获取底层的ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func newBufferWriter() *bufferWriter {
+	return &bufferWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(w.status)
+	return w.body.Write(data)
+}
+
+func (w *bufferWriter) Written() bool {
+	return w.wroteHeader
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	if !w.wroteHeader {
+		return noWritten
+	}
+	return w.body.Len()
+}
+
+// 缓冲的响应无法被接管
+func (w *bufferWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("the buffered ResponseWriter doesn't support the Hijacker interface")
+}
+
+// 缓冲的响应在写出前不会刷新
+func (w *bufferWriter) Flush() {}
+
+func (w *bufferWriter) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func (w *bufferWriter) Push(string, *http.PushOptions) error {
+	return http.ErrNotSupported
+}
+
+// 将缓冲的响应写出到dst
+func (w *bufferWriter) writeTo(dst http.ResponseWriter) error {
+	h := dst.Header()
+	for k, v := range w.header {
+		h[k] = v
+	}
+
+	if !w.wroteHeader {
+		return nil
+	}
+	dst.WriteHeader(w.status)
+	_, err := dst.Write(w.body.Bytes())
+	return err
 }
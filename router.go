@@ -1,7 +1,10 @@
 package yun
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 )
 
 /*const (
@@ -22,6 +25,8 @@ type (
 		Put(...HandlerFunc) IRoute
 		Trace(...HandlerFunc) IRoute
 		Any(...HandlerFunc)
+		Name(string) IRoute
+		WebSocket(func(*Conn)) IRoute
 	}
 
 	route struct {
@@ -46,6 +51,10 @@ type (
 		path     *node
 		paramNum uint8
 		handlers Handlers
+		//levels 路径级数，仅用于以适配节点结尾的路由
+		levels uint8
+		//pattern 注册的路由路径
+		pattern string
 	}
 
 	router struct {
@@ -54,6 +63,13 @@ type (
 
 		staticRoutes  map[staticRouteKey]Handlers
 		dynamicRoutes map[dynamicRouteKey][]*dynamicRoute
+
+		//names 命名路由，名称 => 路由路径
+		names map[string]string
+		//preflights 已登记预检执行链的路由路径
+		preflights map[string]bool
+		//groupLevels 路由所属路由组路径的级数，方法与路由路径 => 级数
+		groupLevels map[staticRouteKey]int
 	}
 )
 
@@ -70,6 +86,9 @@ const (
 	POST    = "POST"
 	PUT     = "PUT"
 	TRACE   = "TRACE"
+
+	//preflightMethod 预检执行链使用的内部方法名，含空格因而不会与真实请求冲突
+	preflightMethod = " OPTIONS"
 )
 
 type routeType int
@@ -163,10 +182,34 @@ func (r *route) Any(handlers ...HandlerFunc) {
 	r.handle(CONNECT, handlers)
 }
 
+//Name 为路由命名，用于反向生成URL
+//name 路由名称
+//return 路由接口
+func (r *route) Name(name string) IRoute {
+	if _, has := r.router.names[name]; has {
+		panic("This route name already exists")
+	}
+
+	r.router.names[name] = r.path
+	return r
+}
+
 //handle: 处理路由
 func (r *route) handle(meth string, handlers Handlers) {
-	handlers = r.mergeHandlers(handlers)
+	r.register(meth, r.mergeHandlers(handlers))
+	if g, ok := r.group.(*Group); ok {
+		r.router.groupLevels[staticRouteKey{method: meth, path: r.path}] = strings.Count(strings.TrimRight(g.path, "/"), "/")
+	}
+
+	//登记仅包含中间件的预检执行链，使未注册OPTIONS的路由也能由路由组中间件处理预检请求
+	if meth != OPTIONS && !r.router.preflights[r.path] {
+		r.router.preflights[r.path] = true
+		r.register(preflightMethod, r.mergeHandlers(nil))
+	}
+}
 
+//register: 登记路由的执行链
+func (r *route) register(meth string, handlers Handlers) {
 	if r.ruType == sTATIC {
 		if r.router.staticRoutes == nil {
 			r.router.staticRoutes = make(map[staticRouteKey]Handlers)
@@ -197,6 +240,7 @@ func (r *route) dynamicHandle(meth string, handlers Handlers) {
 	//创建动态路由
 	ds := new(dynamicRoute)
 	ds.handlers = handlers
+	ds.pattern = r.path
 
 	var (
 		nodeStart, nodeEnd int
@@ -256,6 +300,11 @@ func (r *route) dynamicHandle(meth string, handlers Handlers) {
 		method: meth,
 		levels: levels,
 	}
+	//以适配节点结尾的路由可匹配任意多级路径，以0级登记；路径中间的适配节点只匹配一级
+	if nod.ntype == cATCHAll {
+		ds.levels = levels
+		key.levels = 0
+	}
 	if rs, has := r.router.dynamicRoutes[key]; has {
 		rs = append(rs, ds)
 		r.router.dynamicRoutes[key] = rs
@@ -302,3 +351,37 @@ func (r *route) mergeHandlers(handlers Handlers) Handlers {
 
 	return hs
 }
+
+//URL 根据命名路由生成URL
+//name 路由名称
+//params 按顺序替换路由中的参数
+//return 返回URL、错误
+func (eng *Engine) URL(name string, params ...interface{}) (string, error) {
+	rpath, has := eng.router.names[name]
+	if !has {
+		return "", fmt.Errorf("Route name \"%s\" does not exist", name)
+	}
+
+	segs := strings.Split(rpath, "/")
+	n := 0
+	for i, seg := range segs {
+		if len(seg) == 0 || seg[0] != ':' && seg[0] != '*' {
+			continue
+		}
+		if n >= len(params) {
+			return "", errors.New("Not enough parameters for route \"" + name + "\"")
+		}
+
+		v := fmt.Sprint(params[n])
+		if seg[0] == ':' {
+			v = url.PathEscape(v)
+		}
+		segs[i] = v
+		n++
+	}
+
+	if n != len(params) {
+		return "", errors.New("Too many parameters for route \"" + name + "\"")
+	}
+	return strings.Join(segs, "/"), nil
+}
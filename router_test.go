@@ -0,0 +1,73 @@
+package yun
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//TestDynamicRoutes 适配节点、固定结尾与路由优先级
+func TestDynamicRoutes(t *testing.T) {
+	eng := New(RELEASE)
+	handler := func(c *Context) {
+		params := make([]string, len(c.Params))
+		for i, p := range c.Params {
+			params[i] = p.Key + "=" + p.Value
+		}
+		c.String(http.StatusOK, c.FullPath()+" "+strings.Join(params, ","))
+	}
+	for _, path := range []string{
+		"/files/*path",
+		"/users/:id/edit",
+		"/assets/*path",
+		"/assets/:name/info",
+		"/api/*rest",
+		"/api/v1/*rest",
+		"/api/v1/health",
+		"/mid/*seg/end",
+	} {
+		eng.Handle(path).Get(handler)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/files/a", "/files/*path path=a"},
+		{"/files/a/b/c.txt", "/files/*path path=a/b/c.txt"},
+		{"/files", ""},
+		{"/filesx/a", ""},
+
+		{"/users/1/edit", "/users/:id/edit id=1"},
+		{"/users/1/editor", ""},
+		{"/users/1/edi", ""},
+		{"/users/1/edit/more", ""},
+
+		{"/assets/logo/info", "/assets/:name/info name=logo"},
+		{"/assets/img/logo.png", "/assets/*path path=img/logo.png"},
+		{"/assets/logo/info/more", "/assets/*path path=logo/info/more"},
+
+		{"/api/v1/health", "/api/v1/health "},
+		{"/api/v1/users/1", "/api/v1/*rest rest=users/1"},
+		{"/api/v2/users/1", "/api/*rest rest=v2/users/1"},
+
+		{"/mid/x/end", "/mid/*seg/end seg=x"},
+		{"/mid/x/y/end", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			eng.ServeHTTP(w, httptest.NewRequest(GET, tt.path, nil))
+			if tt.want == "" {
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("expected 404, got %d %q", w.Code, w.Body.String())
+				}
+				return
+			}
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("expected %q, got %d %q", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package yun
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+//CSPNonceKey 每个请求的CSP nonce在Context中保存的键
+const CSPNonceKey = "csp-nonce"
+
+type (
+	//SecureConfig 安全响应头配置，为空的字段不发送对应响应头
+	SecureConfig struct {
+		//XSSProtection X-XSS-Protection，现代浏览器建议设为"0"关闭过时的过滤器
+		XSSProtection string
+		//ContentTypeNosniff X-Content-Type-Options
+		ContentTypeNosniff string
+		//XFrameOptions X-Frame-Options
+		XFrameOptions string
+		//HSTSMaxAge Strict-Transport-Security的max-age秒数，仅对https请求发送，为0时不发送
+		HSTSMaxAge int
+		//HSTSIncludeSubdomains HSTS是否包含子域名
+		HSTSIncludeSubdomains bool
+		//HSTSPreload HSTS是否申请预加载
+		HSTSPreload bool
+		//ContentSecurityPolicy 内容安全策略，其中的"{nonce}"将替换为每个请求生成的nonce
+		ContentSecurityPolicy string
+		//CSPReportOnly 是否以Content-Security-Policy-Report-Only发送，只报告不拦截
+		CSPReportOnly bool
+		//CSPNonce 是否总是生成nonce，策略中包含"{nonce}"时自动生成
+		CSPNonce bool
+		//ReferrerPolicy Referrer-Policy
+		ReferrerPolicy string
+	}
+)
+
+//DefaultSecureConfig 默认的安全响应头配置
+var DefaultSecureConfig = SecureConfig{
+	XSSProtection:         "0",
+	ContentTypeNosniff:    "nosniff",
+	XFrameOptions:         "SAMEORIGIN",
+	HSTSMaxAge:            31536000,
+	HSTSIncludeSubdomains: true,
+	ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'self'; frame-ancestors 'self'",
+	ReferrerPolicy:        "strict-origin-when-cross-origin",
+}
+
+//Secure 安全响应头中间件
+//生成的CSP nonce通过Context.Get(CSPNonceKey)获取，可在模板中使用 {{index . "csp-nonce"}}
+//config 安全配置，为空时使用DefaultSecureConfig
+//return 中间件
+func Secure(config ...SecureConfig) HandlerFunc {
+	cfg := DefaultSecureConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(cfg.HSTSMaxAge)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	cspHeader := HeaderContentSecurityPolicy
+	if cfg.CSPReportOnly {
+		cspHeader = HeaderContentSecurityPolicyReportOnly
+	}
+	useNonce := cfg.CSPNonce || strings.Contains(cfg.ContentSecurityPolicy, "{nonce}")
+
+	return func(c *Context) {
+		h := c.Response().Header()
+
+		if cfg.XSSProtection != "" {
+			h.Set(HeaderXXSSProtection, cfg.XSSProtection)
+		}
+		if cfg.ContentTypeNosniff != "" {
+			h.Set(HeaderXContentTypeOptions, cfg.ContentTypeNosniff)
+		}
+		if cfg.XFrameOptions != "" {
+			h.Set(HeaderXFrameOptions, cfg.XFrameOptions)
+		}
+		if hsts != "" && c.engine.isHTTPS(c.Request()) {
+			h.Set(HeaderStrictTransportSecurity, hsts)
+		}
+		if cfg.ReferrerPolicy != "" {
+			h.Set(HeaderReferrerPolicy, cfg.ReferrerPolicy)
+		}
+
+		csp := cfg.ContentSecurityPolicy
+		if useNonce {
+			nonce := newNonce()
+			c.Set(CSPNonceKey, nonce)
+			csp = strings.ReplaceAll(csp, "{nonce}", nonce)
+		}
+		if csp != "" {
+			h.Set(cspHeader, csp)
+		}
+
+		c.Next()
+	}
+}
+
+//newNonce: 生成随机nonce
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,227 @@
+package yun
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//DefaultShutdownTimeout 默认的优雅关闭超时时间
+const DefaultShutdownTimeout = 30 * time.Second
+
+//OnStart 注册启动钩子，每次运行开始监听前按注册顺序执行，多个监听器同时运行时只执行一次，返回错误时中止启动
+//fn 钩子函数
+func (eng *Engine) OnStart(fn func() error) {
+	eng.serverLock.Lock()
+	eng.onStart = append(eng.onStart, fn)
+	eng.serverLock.Unlock()
+}
+
+//OnShutdown 注册关闭钩子，在全部请求处理完毕后按注册顺序执行
+//fn 钩子函数
+func (eng *Engine) OnShutdown(fn func(context.Context)) {
+	eng.serverLock.Lock()
+	eng.onShutdown = append(eng.onShutdown, fn)
+	eng.serverLock.Unlock()
+}
+
+//RunWithContext 运行http服务，ctx结束时优雅关闭
+//ctx 服务的生命周期
+//addr 服务地址
+//return 返回错误
+func (eng *Engine) RunWithContext(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	eng.printDebugInfo("Listening and serving HTTP on %s\n", addr)
+	return eng.serve(ctx, ln, eng.newServer())
+}
+
+//Shutdown 优雅关闭全部http服务：停止接收新连接，等待处理中的请求完成后执行关闭钩子
+//ctx 关闭的期限，到期后强制关闭
+//return 返回错误
+func (eng *Engine) Shutdown(ctx context.Context) error {
+	first := atomic.CompareAndSwapInt32(&eng.shuttingDown, 0, 1)
+
+	eng.serverLock.Lock()
+	servers := eng.servers
+	eng.servers = nil
+	hooks := eng.onShutdown
+	eng.serverLock.Unlock()
+
+	for _, srv := range servers {
+		srv.SetKeepAlivesEnabled(false)
+	}
+
+	//等待负载均衡摘除本实例后再停止监听
+	if first && eng.ShutdownDelay > 0 {
+		select {
+		case <-time.After(eng.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	var err error
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if first {
+		for _, fn := range hooks {
+			fn(ctx)
+		}
+	}
+
+	return err
+}
+
+//IsShuttingDown 是否正在关闭或已关闭，再次运行时恢复，可用于就绪探针
+func (eng *Engine) IsShuttingDown() bool {
+	return atomic.LoadInt32(&eng.shuttingDown) == 1
+}
+
+//signalContext: 收到SIGINT或SIGTERM时结束的上下文，再次收到信号时进程按默认方式退出
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+//newServer: 按引擎配置创建http服务
+func (eng *Engine) newServer() *http.Server {
+	return &http.Server{
+		Handler:           eng,
+		ReadTimeout:       eng.ReadTimeout,
+		ReadHeaderTimeout: eng.ReadHeaderTimeout,
+		WriteTimeout:      eng.WriteTimeout,
+		IdleTimeout:       eng.IdleTimeout,
+		MaxHeaderBytes:    eng.MaxHeaderBytes,
+	}
+}
+
+//serve: 在监听器上运行http服务，ctx结束时优雅关闭
+func (eng *Engine) serve(ctx context.Context, ln net.Listener, srv *http.Server) error {
+	if eng.ProxyProtocol {
+		ln = ProxyProtocolListener(ln, ProxyProtocolConfig{
+			TrustedUpstreams: eng.TrustedProxies,
+			Required:         eng.ProxyProtocolRequired,
+		})
+	}
+
+	if err := eng.runStartHooks(); err != nil {
+		ln.Close()
+		return err
+	}
+	defer eng.endRun(srv)
+
+	eng.serverLock.Lock()
+	eng.servers = append(eng.servers, srv)
+	eng.serverLock.Unlock()
+
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errCh <- srv.ServeTLS(ln, "", "")
+		} else {
+			errCh <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := eng.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	eng.printDebugInfo("Shutting down HTTP server on %s\n", ln.Addr())
+	if err := eng.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+//runStartHooks: 没有正在运行的服务时执行启动钩子并清除上次运行的关闭状态，钩子返回错误时下次运行重新执行
+func (eng *Engine) runStartHooks() error {
+	eng.startLock.Lock()
+	defer eng.startLock.Unlock()
+
+	if eng.running > 0 {
+		eng.running++
+		return nil
+	}
+
+	eng.serverLock.Lock()
+	hooks := eng.onStart
+	eng.serverLock.Unlock()
+
+	for _, fn := range hooks {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreInt32(&eng.shuttingDown, 0)
+	eng.running = 1
+	return nil
+}
+
+//endRun: 服务结束运行，包括Serve出错时，将其从引擎中移除
+func (eng *Engine) endRun(srv *http.Server) {
+	eng.serverLock.Lock()
+	for i, s := range eng.servers {
+		if s == srv {
+			eng.servers = append(eng.servers[:i], eng.servers[i+1:]...)
+			break
+		}
+	}
+	eng.serverLock.Unlock()
+
+	eng.startLock.Lock()
+	eng.running--
+	eng.startLock.Unlock()
+}
+
+//RunH2C 运行同时支持HTTP/1.1与明文HTTP/2（h2c，需客户端预先知晓）的服务，收到SIGINT或SIGTERM时优雅关闭
+//addr 服务地址
+//return 返回错误
+func (eng *Engine) RunH2C(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := eng.newServer()
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+
+	eng.printDebugInfo("Listening and serving h2c on %s\n", addr)
+	return eng.serve(signalContext(), ln, srv)
+}
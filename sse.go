@@ -0,0 +1,185 @@
+package yun
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	//Event 服务端推送事件
+	Event struct {
+		//ID 事件ID，客户端重连时通过Last-Event-ID回传
+		ID string
+		//Event 事件名称，为空时客户端按message处理
+		Event string
+		//Data 事件数据，非字符串、[]byte的数据将编码为JSON
+		Data interface{}
+		//Retry 建议客户端的重连间隔，为0时不发送
+		Retry time.Duration
+	}
+)
+
+//SSEvent 推送命名事件
+//name 事件名称
+//data 事件数据
+//return 返回错误
+func (c *Context) SSEvent(name string, data interface{}) error {
+	return c.WriteEvent(Event{Event: name, Data: data})
+}
+
+//WriteEvent 推送事件并立即刷新
+//e 事件
+//return 返回错误
+func (c *Context) WriteEvent(e Event) error {
+	c.sseHeader()
+
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: ")
+		b.WriteString(sseEscape(e.ID))
+		b.WriteByte('\n')
+	}
+	if e.Event != "" {
+		b.WriteString("event: ")
+		b.WriteString(sseEscape(e.Event))
+		b.WriteByte('\n')
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: ")
+		b.WriteString(strconv.FormatInt(int64(e.Retry/time.Millisecond), 10))
+		b.WriteByte('\n')
+	}
+
+	data, err := sseData(e.Data)
+	if err != nil {
+		return err
+	}
+	data = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data)
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	if _, err = io.WriteString(c.ResponseWriter, b.String()); err != nil {
+		return err
+	}
+	c.Flush()
+	return nil
+}
+
+//SSEHeartbeat 推送心跳注释，保持连接不被代理断开
+//return 返回错误
+func (c *Context) SSEHeartbeat() error {
+	c.sseHeader()
+	if _, err := io.WriteString(c.ResponseWriter, ": ping\n\n"); err != nil {
+		return err
+	}
+	c.Flush()
+	return nil
+}
+
+//LastEventID 获取客户端重连时携带的最后事件ID
+//return 事件ID，首次连接时为空
+func (c *Context) LastEventID() string {
+	if id := c.Request().Header.Get(HeaderLastEventID); id != "" {
+		return id
+	}
+	return c.Form("lastEventId")
+}
+
+//Stream 流式响应，每步执行后刷新，客户端断开时停止
+//step 每步的写操作，返回false时结束
+//return 客户端是否已断开
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	done := c.Request().Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+			keepOpen := step(c.ResponseWriter)
+			c.Flush()
+			if !keepOpen {
+				return false
+			}
+		}
+	}
+}
+
+//StreamEvents 持续推送通道中的事件，空闲时发送心跳，通道关闭或客户端断开时停止
+//events 事件通道
+//heartbeat 心跳间隔，为0时不发送心跳
+//return 客户端是否已断开
+func (c *Context) StreamEvents(events <-chan Event, heartbeat time.Duration) bool {
+	c.sseHeader()
+	c.Flush()
+
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	done := c.Request().Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			if err := c.WriteEvent(e); err != nil {
+				return true
+			}
+		case <-tick:
+			if err := c.SSEHeartbeat(); err != nil {
+				return true
+			}
+		}
+	}
+}
+
+//sseHeader: 首次推送前设置事件流响应头
+func (c *Context) sseHeader() {
+	if c.Written() {
+		return
+	}
+
+	h := c.Response().Header()
+	h.Set(HeaderContentType, MIMETextEventStream)
+	h.Set(HeaderCacheControl, "no-cache")
+	h.Set(HeaderConnection, "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.WriteHeader(http.StatusOK)
+}
+
+//sseData: 将事件数据转换为字符串
+func sseData(data interface{}) (string, error) {
+	switch d := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return d, nil
+	case []byte:
+		return string(d), nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//sseEscape: 去除字段中的换行，防止注入额外字段
+func sseEscape(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,266 @@
+package yun
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//staticParam 静态文件路由的适配参数名
+const staticParam = "filepath"
+
+type (
+	//StaticConfig 静态文件服务配置
+	StaticConfig struct {
+		//Index 目录的索引文件
+		Index string
+		//Browse 目录中没有索引文件时是否列出目录内容
+		Browse bool
+		//SPA 单页应用模式，不存在且无扩展名的路径回退到根目录的索引文件
+		SPA bool
+		//Precompressed 客户端接受gzip时优先发送同名的.gz文件
+		Precompressed bool
+		//CacheControl 按扩展名设置的Cache-Control，如".js": "public, max-age=31536000"，"*"为默认值
+		CacheControl map[string]string
+	}
+
+	//staticServer 静态文件服务
+	staticServer struct {
+		fsys fs.FS
+		cfg  StaticConfig
+	}
+)
+
+//DefaultStaticConfig 默认的静态文件服务配置
+var DefaultStaticConfig = StaticConfig{
+	Index: "index.html",
+}
+
+//Static 注册本地目录的静态文件服务，路径穿越及指向目录外的符号链接将被拒绝
+//prefix 路由前缀
+//root 本地目录
+//config 静态文件配置，为空时使用DefaultStaticConfig
+func (eng *Engine) Static(prefix, root string, config ...StaticConfig) {
+	serveStatic(eng, prefix, dirFS(root), config)
+}
+
+//StaticFS 注册文件系统的静态文件服务，如embed.FS（可配合fs.Sub使用）
+//prefix 路由前缀
+//fsys 文件系统
+//config 静态文件配置，为空时使用DefaultStaticConfig
+func (eng *Engine) StaticFS(prefix string, fsys fs.FS, config ...StaticConfig) {
+	serveStatic(eng, prefix, fsys, config)
+}
+
+//Static 在路由组下注册本地目录的静态文件服务，请求经过组中间件
+//prefix 路由前缀
+//root 本地目录
+//config 静态文件配置，为空时使用DefaultStaticConfig
+func (g *Group) Static(prefix, root string, config ...StaticConfig) {
+	serveStatic(g, prefix, dirFS(root), config)
+}
+
+//StaticFS 在路由组下注册文件系统的静态文件服务
+//prefix 路由前缀
+//fsys 文件系统
+//config 静态文件配置，为空时使用DefaultStaticConfig
+func (g *Group) StaticFS(prefix string, fsys fs.FS, config ...StaticConfig) {
+	serveStatic(g, prefix, fsys, config)
+}
+
+//dirFS: 以root为界的本地文件系统
+func dirFS(root string) fs.FS {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		panic(err)
+	}
+	return r.FS()
+}
+
+//serveStatic: 注册前缀本身及其下任意路径的GET、HEAD路由
+func serveStatic(g IGroup, prefix string, fsys fs.FS, config []StaticConfig) {
+	if strings.ContainsAny(prefix, ":*") {
+		panic("Static prefix cannot contain parameters: " + prefix)
+	}
+
+	s := &staticServer{fsys: fsys, cfg: DefaultStaticConfig}
+	if len(config) > 0 {
+		s.cfg = config[0]
+	}
+
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" {
+		g.Handle(prefix).Get(s.serve).Head(s.serve)
+	}
+	g.Handle(prefix + "/*" + staticParam).Get(s.serve).Head(s.serve)
+}
+
+//serve: 处理静态文件请求
+func (s *staticServer) serve(c *Context) {
+	raw, _ := c.Params.Get(staticParam)
+	name := path.Clean("/" + raw)[1:]
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) || strings.Contains(name, "\\") {
+		c.String(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && s.cfg.SPA && path.Ext(name) == "" && s.cfg.Index != "" {
+			s.serveFile(c, s.cfg.Index)
+			return
+		}
+		s.serveError(c, err)
+		return
+	}
+
+	if !info.IsDir() {
+		s.serveFile(c, name)
+		return
+	}
+
+	//目录必须以"/"结尾，以便正确解析相对路径
+	reqPath := c.Request().URL.Path
+	if !strings.HasSuffix(reqPath, "/") {
+		target := reqPath + "/"
+		if q := c.Request().URL.RawQuery; q != "" {
+			target += "?" + q
+		}
+		http.Redirect(c.Response(), c.Request(), target, http.StatusMovedPermanently)
+		return
+	}
+
+	if s.cfg.Index != "" {
+		index := path.Join(name, s.cfg.Index)
+		if fi, err := fs.Stat(s.fsys, index); err == nil && !fi.IsDir() {
+			s.serveFile(c, index)
+			return
+		}
+	}
+	if s.cfg.Browse {
+		s.serveDir(c, name)
+		return
+	}
+	c.String(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+}
+
+//serveFile: 发送文件，支持Range与条件请求
+func (s *staticServer) serveFile(c *Context, name string) {
+	h := c.Response().Header()
+	ext := path.Ext(name)
+
+	if cc, has := s.cfg.CacheControl[ext]; has {
+		h.Set(HeaderCacheControl, cc)
+	} else if cc, has := s.cfg.CacheControl["*"]; has {
+		h.Set(HeaderCacheControl, cc)
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		h.Set(HeaderContentType, ct)
+	}
+
+	sendName := name
+	if s.cfg.Precompressed {
+		addVary(h, HeaderAcceptEncoding)
+		if negotiateEncoding(c.Request().Header.Get(HeaderAcceptEncoding)) == EncodingGzip {
+			if fi, err := fs.Stat(s.fsys, name+".gz"); err == nil && !fi.IsDir() {
+				sendName = name + ".gz"
+				h.Set(HeaderContentEncoding, EncodingGzip)
+			}
+		}
+	}
+
+	f, err := s.fsys.Open(sendName)
+	if err != nil {
+		h.Del(HeaderContentEncoding)
+		s.serveError(c, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		h.Del(HeaderContentEncoding)
+		s.serveError(c, err)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			h.Del(HeaderContentEncoding)
+			s.serveError(c, err)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+
+	http.ServeContent(c.Response(), c.Request(), path.Base(name), info.ModTime(), content)
+}
+
+//serveDir: 列出目录内容
+func (s *staticServer) serveDir(c *Context, name string) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		s.serveError(c, err)
+		return
+	}
+
+	var b strings.Builder
+	title := html.EscapeString(c.Request().URL.Path)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1>\n<pre>\n", title, title)
+	if name != "." {
+		b.WriteString("<a href=\"../\">../</a>\n")
+	}
+	for _, e := range entries {
+		n := e.Name()
+		var modTime time.Time
+		if fi, err := e.Info(); err == nil {
+			modTime = fi.ModTime()
+		}
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>", u.String(), html.EscapeString(n))
+		if !modTime.IsZero() {
+			fmt.Fprintf(&b, "  %s", modTime.UTC().Format(time.RFC1123))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("</pre>\n</body></html>\n")
+
+	c.HTML(http.StatusOK, b.String())
+}
+
+//serveError: 将文件系统错误转换为响应状态码
+func (s *staticServer) serveError(c *Context, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.String(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	case errors.Is(err, fs.ErrPermission), isPathEscape(err):
+		c.String(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+	default:
+		c.engine.printError(err)
+		c.String(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+//isPathEscape: 是否为os.Root拒绝的目录外路径，如指向目录外的符号链接
+func isPathEscape(err error) bool {
+	var pe *fs.PathError
+	return errors.As(err, &pe) && strings.Contains(pe.Err.Error(), "escapes from parent")
+}
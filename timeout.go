@@ -0,0 +1,212 @@
+package yun
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type (
+	//timeoutWriter 超时前缓冲响应，超时后丢弃后续写入；Flush或Hijack后直接写出到w
+	timeoutWriter struct {
+		*bufferWriter
+		w         ResponseWriter
+		lock      sync.Mutex
+		timedOut  bool
+		committed bool
+	}
+)
+
+//Timeout 请求超时中间件，剩余的handler在截止时间内执行
+//响应先写入缓冲区，超时后处理函数的写入将被丢弃，超时响应只写出一次
+//处理函数调用Flush或Hijack（如SSE、WebSocket）后响应直接写出，此后超时只取消context，中间件等待处理函数返回
+//超时后处理函数在后台使用请求的副本运行至返回，请求体可能已关闭，之后的panic只记录到Engine.Logger
+//d 超时时间
+//onTimeout 超时时执行的handler，为空时响应503
+//return 中间件
+func Timeout(d time.Duration, onTimeout ...HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.requestContext(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{bufferWriter: newBufferWriter(), w: c.ResponseWriter}
+		cp := c.fork(tw)
+		cp.request = c.request.Clone(ctx)
+
+		done := make(chan struct{})
+		panicCh := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					tw.lock.Lock()
+					defer tw.lock.Unlock()
+
+					if tw.timedOut {
+						cp.Logger().Errorf("panic after timeout: %v\n%s", p, debug.Stack())
+						return
+					}
+					panicCh <- p
+				}
+			}()
+			cp.Next()
+			close(done)
+		}()
+
+		select {
+		case p := <-panicCh:
+			panic(p)
+		case <-done:
+			c.keys = cp.keys
+			if !tw.committed {
+				tw.writeTo(c.ResponseWriter)
+			}
+			c.Abort()
+			return
+		case <-ctx.Done():
+		}
+
+		tw.lock.Lock()
+		select {
+		case p := <-panicCh:
+			tw.lock.Unlock()
+			panic(p)
+		default:
+		}
+
+		//响应已开始写出，无法再替换为超时响应
+		if tw.committed {
+			tw.lock.Unlock()
+			select {
+			case p := <-panicCh:
+				panic(p)
+			case <-done:
+				c.keys = cp.keys
+			}
+			c.Abort()
+			return
+		}
+
+		tw.timedOut = true
+		tw.lock.Unlock()
+
+		c.Abort()
+		if len(onTimeout) > 0 {
+			onTimeout[0](c)
+		}
+		if !c.Written() {
+			c.String(http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+		}
+	}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.committed {
+		return w.w.Header()
+	}
+	return w.bufferWriter.Header()
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	switch {
+	case w.timedOut:
+	case w.committed:
+		w.w.WriteHeader(code)
+	default:
+		w.bufferWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	switch {
+	case w.timedOut:
+		return 0, http.ErrHandlerTimeout
+	case w.committed:
+		return w.w.Write(data)
+	}
+	return w.bufferWriter.Write(data)
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.committed {
+		return w.w.Written()
+	}
+	return w.bufferWriter.Written()
+}
+
+func (w *timeoutWriter) Status() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.committed {
+		return w.w.Status()
+	}
+	return w.bufferWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.committed {
+		return w.w.Size()
+	}
+	return w.bufferWriter.Size()
+}
+
+//Flush 写出已缓冲的响应，之后的写入直接写出
+func (w *timeoutWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.timedOut {
+		return
+	}
+	if !w.committed {
+		w.committed = true
+		w.bufferWriter.writeTo(w.w)
+	}
+	w.w.Flush()
+}
+
+//Hijack 接管连接，已设置的响应头交由调用方写出
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.timedOut {
+		return nil, nil, errors.New("the ResponseWriter has timed out")
+	}
+	if !w.committed {
+		w.committed = true
+		h := w.w.Header()
+		for k, v := range w.bufferWriter.Header() {
+			h[k] = v
+		}
+	}
+	return w.w.Hijack()
+}
+
+func (w *timeoutWriter) CloseNotify() <-chan bool {
+	return w.w.CloseNotify()
+}
+
+func (w *timeoutWriter) Push(target string, opts *http.PushOptions) error {
+	return w.w.Push(target, opts)
+}
@@ -0,0 +1,227 @@
+package yun
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//certCheckInterval 检查证书文件变化的最小间隔
+const certCheckInterval = time.Second
+
+type (
+	//certReloader 证书文件变化时自动重新加载
+	certReloader struct {
+		lock     sync.RWMutex
+		certFile string
+		keyFile  string
+		cert     *tls.Certificate
+		modTime  time.Time
+		checked  time.Time
+		onError  func(error)
+	}
+)
+
+//RunTLS 运行https服务，证书文件变化时自动重新加载，收到SIGINT或SIGTERM时优雅关闭
+//addr 服务地址
+//certFile 证书文件
+//keyFile 私钥文件
+//return 返回错误
+func (eng *Engine) RunTLS(addr, certFile, keyFile string) error {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	reloader.onError = eng.printError
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		ClientCAs:      eng.ClientCAs,
+		ClientAuth:     eng.ClientAuth,
+	}
+	return eng.RunWithTLSConfig(addr, cfg)
+}
+
+//RunWithTLSConfig 使用指定的TLS配置运行https服务，收到SIGINT或SIGTERM时优雅关闭
+//addr 服务地址
+//cfg TLS配置，不能为nil
+//return 返回错误
+func (eng *Engine) RunWithTLSConfig(addr string, cfg *tls.Config) error {
+	if cfg == nil {
+		return errors.New("TLS config is required")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := eng.newServer()
+	srv.TLSConfig = cfg
+
+	eng.printDebugInfo("Listening and serving HTTPS on %s\n", addr)
+	return eng.serve(signalContext(), ln, srv)
+}
+
+//RunHTTPSRedirect 运行将http请求重定向到https的服务
+//已由可信代理（Engine.TrustedProxies）终止TLS（X-Forwarded-Proto为https）的请求直接交由引擎处理
+//addr 服务地址
+//httpsPort https服务端口，为空时使用默认端口
+//return 返回错误
+func (eng *Engine) RunHTTPSRedirect(addr, httpsPort string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := eng.newServer()
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if eng.isHTTPS(req) {
+			eng.ServeHTTP(w, req)
+			return
+		}
+		redirectHTTPS(w, req, httpsPort)
+	})
+
+	eng.printDebugInfo("Redirecting HTTP on %s to HTTPS\n", addr)
+	return eng.serve(signalContext(), ln, srv)
+}
+
+//HTTPSRedirect 将非https请求重定向到https的中间件，X-Forwarded-Proto仅在来自可信代理时生效
+//return 中间件
+func HTTPSRedirect() HandlerFunc {
+	return func(c *Context) {
+		if c.engine.isHTTPS(c.Request()) {
+			c.Next()
+			return
+		}
+
+		redirectHTTPS(c.ResponseWriter, c.Request(), "")
+		c.Abort()
+	}
+}
+
+//VerifiedChains 获取已验证的客户端证书链
+//return 证书链，未启用客户端证书验证时为nil
+func (c *Context) VerifiedChains() [][]*x509.Certificate {
+	if c.Request().TLS == nil {
+		return nil
+	}
+	return c.Request().TLS.VerifiedChains
+}
+
+//ClientCertificate 获取已验证的客户端证书
+//return 客户端证书，未验证时为nil
+func (c *Context) ClientCertificate() *x509.Certificate {
+	chains := c.VerifiedChains()
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil
+	}
+	return chains[0][0]
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//GetCertificate 实现tls.Config.GetCertificate，证书文件更新后返回新证书
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	stale := time.Since(r.checked) >= certCheckInterval
+	cert := r.cert
+	r.lock.RUnlock()
+
+	if !stale {
+		return cert, nil
+	}
+
+	if err := r.load(); err != nil && r.onError != nil {
+		r.onError(err)
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+//load: 证书或私钥文件修改时间变化时重新加载
+func (r *certReloader) load() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.checked = time.Now()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+//isHTTPS: 请求是否经由https到达，仅信任可信代理设置的X-Forwarded-Proto
+func (eng *Engine) isHTTPS(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	if !eng.isTrustedPeer(req.RemoteAddr) {
+		return false
+	}
+	proto := req.Header.Get(HeaderXForwardedProto)
+	if i := strings.IndexByte(proto, ','); i >= 0 {
+		proto = proto[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+//redirectHTTPS: 重定向到同一地址的https版本
+func redirectHTTPS(w http.ResponseWriter, req *http.Request, port string) {
+	host := (&url.URL{Host: req.Host}).Hostname()
+	if port != "" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.IndexByte(host, ':') >= 0 {
+		host = "[" + host + "]"
+	}
+
+	code := http.StatusMovedPermanently
+	if req.Method != GET && req.Method != HEAD {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), code)
+}
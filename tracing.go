@@ -0,0 +1,722 @@
+package yun
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//SpanKind的取值
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+)
+
+//SpanStatus的取值
+const (
+	StatusUnset SpanStatus = iota
+	StatusOK
+	StatusError
+)
+
+const (
+	//maxTraceStateLength tracestate的最大长度
+	maxTraceStateLength = 512
+	//maxTraceStateMembers tracestate的最大成员数
+	maxTraceStateMembers = 32
+)
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+type (
+	//SpanKind span的类型
+	SpanKind int
+
+	//SpanStatus span的状态
+	SpanStatus int
+
+	//TraceID 16字节的追踪ID
+	TraceID [16]byte
+
+	//SpanID 8字节的span ID
+	SpanID [8]byte
+
+	//SpanContext 跨进程传播的追踪信息
+	SpanContext struct {
+		TraceID TraceID
+		SpanID  SpanID
+		//Flags 追踪标志，最低位为采样标志
+		Flags byte
+		//TraceState 厂商自定义的追踪状态
+		TraceState string
+	}
+
+	//SpanEvent span中的事件，如错误
+	SpanEvent struct {
+		Name       string                 `json:"name"`
+		Time       time.Time              `json:"time"`
+		Attributes map[string]interface{} `json:"attributes,omitempty"`
+	}
+
+	//SpanData 结束后交给SpanExporter导出的span
+	SpanData struct {
+		Name          string                 `json:"name"`
+		Kind          SpanKind               `json:"kind"`
+		TraceID       TraceID                `json:"traceId"`
+		SpanID        SpanID                 `json:"spanId"`
+		ParentSpanID  SpanID                 `json:"parentSpanId"`
+		TraceState    string                 `json:"traceState,omitempty"`
+		Start         time.Time              `json:"start"`
+		End           time.Time              `json:"end"`
+		Attributes    map[string]interface{} `json:"attributes,omitempty"`
+		Events        []SpanEvent            `json:"events,omitempty"`
+		Status        SpanStatus             `json:"status"`
+		StatusMessage string                 `json:"statusMessage,omitempty"`
+	}
+
+	//Span 一次操作的追踪记录，方法可在nil上安全调用
+	Span struct {
+		tracer *tracer
+		flags  byte
+		lock   sync.Mutex
+		data   SpanData
+		ended  bool
+	}
+
+	//SpanExporter span导出器
+	SpanExporter interface {
+		//ExportSpans 导出一批span
+		ExportSpans(ctx context.Context, spans []*SpanData) error
+		//Shutdown 关闭导出器
+		Shutdown(ctx context.Context) error
+	}
+
+	//TracingConfig 链路追踪配置
+	TracingConfig struct {
+		//Exporter span导出器
+		Exporter SpanExporter
+		//SampleRatio 没有上游追踪信息时的采样比例，0~1，为0时使用1；有上游时沿用其采样标志
+		SampleRatio float64
+		//BatchSize 每批导出的最大span数
+		BatchSize int
+		//BatchTimeout 未满一批时的最长等待时间
+		BatchTimeout time.Duration
+		//QueueSize 等待导出的最大span数，队列满时丢弃新的span
+		QueueSize int
+		//ExportTimeout 每批导出的超时时间
+		ExportTimeout time.Duration
+		//Skipper 返回true时跳过
+		Skipper func(*Context) bool
+		//Engine 使用中间件的引擎，必须设置，在其关闭时停止批处理、导出剩余的span，并使用其Logger记录导出错误
+		Engine *Engine
+	}
+
+	//tracer 采样并将结束的span交给批处理器
+	tracer struct {
+		cfg     TracingConfig
+		queue   chan *SpanData
+		stop    chan struct{}
+		done    chan struct{}
+		dropped uint64
+
+		//ctx 导出使用的上下文，关闭超时时取消以中止正在进行的导出
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		stopOnce sync.Once
+	}
+
+	//spanKey 当前span在context.Context中保存的键
+	spanKey struct{}
+)
+
+//DefaultTracingConfig 默认的链路追踪配置
+var DefaultTracingConfig = TracingConfig{
+	SampleRatio:   1,
+	BatchSize:     512,
+	BatchTimeout:  5 * time.Second,
+	QueueSize:     2048,
+	ExportTimeout: 30 * time.Second,
+}
+
+//Tracing 基于W3C Trace Context的链路追踪中间件
+//解析请求的traceparent、tracestate，为每个请求创建以路由路径命名的服务端span，记录状态码、响应大小与panic
+//请求头的traceparent替换为当前span；Context.Send、Proxy为每次出站请求创建客户端span，并以其作为上游的父span
+//批处理在创建时启动，在TracingConfig.Engine关闭时导出剩余的span并停止
+//config 链路追踪配置
+//return 中间件
+func Tracing(config TracingConfig) HandlerFunc {
+	if config.Exporter == nil {
+		panic("Tracing requires an Exporter")
+	}
+	if config.Engine == nil {
+		panic("Tracing requires an Engine")
+	}
+	if config.SampleRatio <= 0 {
+		config.SampleRatio = DefaultTracingConfig.SampleRatio
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultTracingConfig.BatchSize
+	}
+	if config.BatchTimeout <= 0 {
+		config.BatchTimeout = DefaultTracingConfig.BatchTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultTracingConfig.QueueSize
+	}
+	if config.ExportTimeout <= 0 {
+		config.ExportTimeout = DefaultTracingConfig.ExportTimeout
+	}
+
+	t := &tracer{
+		cfg:   config,
+		queue: make(chan *SpanData, config.QueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	config.Engine.OnShutdown(t.shutdown)
+	go t.run()
+
+	return func(c *Context) {
+		if t.cfg.Skipper != nil && t.cfg.Skipper(c) {
+			c.Next()
+			return
+		}
+
+		req := c.Request()
+		sc := SpanContext{SpanID: newSpanID()}
+		parent, err := ParseTraceparent(req.Header.Get(HeaderTraceparent))
+		if err == nil {
+			sc.TraceID = parent.TraceID
+			sc.Flags = parent.Flags
+			sc.TraceState = parseTraceState(req.Header.Values(HeaderTracestate))
+		} else {
+			sc.TraceID = newTraceID()
+			if t.sample(sc.TraceID) {
+				sc.Flags = 1
+			}
+		}
+
+		name := req.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+		span := t.start(name, SpanKindServer, sc, parent.SpanID)
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.path", req.URL.Path)
+		if route := c.FullPath(); route != "" {
+			span.SetAttribute("http.route", route)
+		}
+		span.SetAttribute("client.address", c.ClientIP())
+		if ua := req.UserAgent(); ua != "" {
+			span.SetAttribute("user_agent.original", ua)
+		}
+
+		req.Header.Set(HeaderTraceparent, sc.Traceparent())
+		if sc.TraceState != "" {
+			req.Header.Set(HeaderTracestate, sc.TraceState)
+		} else {
+			req.Header.Del(HeaderTracestate)
+		}
+		c.WithValue(spanKey{}, span)
+
+		defer func() {
+			if p := recover(); p != nil {
+				span.SetAttribute("http.response.status_code", http.StatusInternalServerError)
+				span.RecordError(fmt.Errorf("panic: %v", p))
+				span.End()
+				panic(p)
+			}
+		}()
+
+		c.Next()
+
+		status := c.Status()
+		span.SetAttribute("http.response.status_code", status)
+		if size := c.Size(); size > 0 {
+			span.SetAttribute("http.response.body.size", size)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(StatusError, http.StatusText(status))
+		}
+		span.End()
+	}
+}
+
+//Span 获取当前请求的服务端span
+//return span，未使用Tracing中间件时为nil
+func (c *Context) Span() *Span {
+	return SpanFromContext(c)
+}
+
+//StartSpan 创建当前请求的服务端span的子span，须调用End结束
+//name span名称
+//return span，未使用Tracing中间件时为nil
+func (c *Context) StartSpan(name string) *Span {
+	return c.Span().StartSpan(name)
+}
+
+//StartSpan 从ctx中的span创建子span，并返回保存子span的context.Context，用于多级嵌套
+//ctx 上下文，如*Context
+//name span名称
+//return 新的上下文、span，ctx中没有span时span为nil
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	span := SpanFromContext(ctx).StartSpan(name)
+	if span == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+//SpanFromContext 获取ctx中的span
+//ctx 上下文
+//return span，不存在时为nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+//StartSpan 创建子span
+//name span名称
+//return span
+func (s *Span) StartSpan(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	sc := s.SpanContext()
+	sc.SpanID = newSpanID()
+	return s.tracer.start(name, SpanKindInternal, sc, s.data.SpanID)
+}
+
+//SpanContext 获取span的追踪信息
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Flags: s.flags, TraceState: s.data.TraceState}
+}
+
+//SetName 修改span名称
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.data.Name = name
+	s.lock.Unlock()
+}
+
+//SetAttribute 设置属性，值可为字符串、布尔、整数、浮点数
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.ended {
+		if s.data.Attributes == nil {
+			s.data.Attributes = make(map[string]interface{})
+		}
+		s.data.Attributes[key] = value
+	}
+	s.lock.Unlock()
+}
+
+//AddEvent 添加事件
+//name 事件名称
+//attrs 事件属性
+func (s *Span) AddEvent(name string, attrs map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.ended {
+		s.data.Events = append(s.data.Events, SpanEvent{Name: name, Time: time.Now(), Attributes: attrs})
+	}
+	s.lock.Unlock()
+}
+
+//RecordError 记录错误事件并将状态设为StatusError
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.AddEvent("exception", map[string]interface{}{
+		"exception.type":    fmt.Sprintf("%T", err),
+		"exception.message": err.Error(),
+	})
+	s.SetStatus(StatusError, err.Error())
+}
+
+//SetStatus 设置状态
+//code 状态
+//msg 描述，仅用于StatusError
+func (s *Span) SetStatus(code SpanStatus, msg string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.ended {
+		s.data.Status = code
+		s.data.StatusMessage = ""
+		if code == StatusError {
+			s.data.StatusMessage = msg
+		}
+	}
+	s.lock.Unlock()
+}
+
+//End 结束span，采样的span将被导出，重复调用无效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.lock.Unlock()
+
+	if s.flags&1 == 1 {
+		s.tracer.enqueue(&data)
+	}
+}
+
+//ParseTraceparent 解析traceparent请求头
+//s 如"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+//return 追踪信息、错误
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	s = strings.TrimSpace(s)
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, errInvalidTraceparent
+	}
+
+	version := s[:2]
+	if !isLowerHex(version) || version == "ff" || version == "00" && len(s) != 55 || len(s) > 55 && s[55] != '-' {
+		return sc, errInvalidTraceparent
+	}
+	if !isLowerHex(s[3:35]) || !isLowerHex(s[36:52]) || !isLowerHex(s[53:55]) {
+		return sc, errInvalidTraceparent
+	}
+
+	hex.Decode(sc.TraceID[:], []byte(s[3:35]))
+	hex.Decode(sc.SpanID[:], []byte(s[36:52]))
+	var flags [1]byte
+	hex.Decode(flags[:], []byte(s[53:55]))
+	sc.Flags = flags[0]
+
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+//Traceparent 生成traceparent请求头
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+//Sampled 是否采样
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&1 == 1
+}
+
+//IsValid 追踪ID与span ID均不为零
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+//String 32位小写十六进制
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+//IsValid 是否不为零
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+//MarshalText 编码为十六进制
+func (id TraceID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+//String 16位小写十六进制
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+//IsValid 是否不为零
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+//MarshalText 编码为十六进制，为零时为空
+func (id SpanID) MarshalText() ([]byte, error) {
+	if !id.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(id.String()), nil
+}
+
+//String 类型名称
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+//MarshalText 编码为类型名称
+func (k SpanKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+//String 状态名称
+func (st SpanStatus) String() string {
+	switch st {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	}
+	return "unset"
+}
+
+//MarshalText 编码为状态名称
+func (st SpanStatus) MarshalText() ([]byte, error) {
+	return []byte(st.String()), nil
+}
+
+//start: 创建span
+func (t *tracer) start(name string, kind SpanKind, sc SpanContext, parent SpanID) *Span {
+	return &Span{
+		tracer: t,
+		flags:  sc.Flags,
+		data: SpanData{
+			Name:         name,
+			Kind:         kind,
+			TraceID:      sc.TraceID,
+			SpanID:       sc.SpanID,
+			ParentSpanID: parent,
+			TraceState:   sc.TraceState,
+			Start:        time.Now(),
+		},
+	}
+}
+
+//sample: 按追踪ID的低8字节确定性采样，同一追踪在各服务的结果一致
+func (t *tracer) sample(id TraceID) bool {
+	if t.cfg.SampleRatio >= 1 {
+		return true
+	}
+	bound := uint64(t.cfg.SampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+//enqueue: 将结束的span放入导出队列，队列满时丢弃
+func (t *tracer) enqueue(d *SpanData) {
+	select {
+	case t.queue <- d:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+//run: 批量导出span，达到BatchSize或BatchTimeout时导出一批
+func (t *tracer) run() {
+	defer close(t.done)
+
+	batch := make([]*SpanData, 0, t.cfg.BatchSize)
+	timer := time.NewTimer(t.cfg.BatchTimeout)
+	defer timer.Stop()
+
+	export := func() {
+		if len(batch) > 0 {
+			t.export(batch)
+			batch = make([]*SpanData, 0, t.cfg.BatchSize)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(t.cfg.BatchTimeout)
+	}
+	drain := func() {
+		for {
+			//关闭超时后丢弃剩余的span
+			if t.ctx.Err() != nil {
+				return
+			}
+			select {
+			case d := <-t.queue:
+				batch = append(batch, d)
+				if len(batch) >= t.cfg.BatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case d := <-t.queue:
+			batch = append(batch, d)
+			if len(batch) >= t.cfg.BatchSize {
+				export()
+			}
+		case <-timer.C:
+			export()
+		case <-t.stop:
+			drain()
+			return
+		}
+	}
+}
+
+//export: 导出一批span
+func (t *tracer) export(batch []*SpanData) {
+	ctx, cancel := context.WithTimeout(t.ctx, t.cfg.ExportTimeout)
+	defer cancel()
+
+	if err := t.cfg.Exporter.ExportSpans(ctx, batch); err != nil {
+		t.logger().Errorf("export %d spans: %v", len(batch), err)
+	}
+	if n := atomic.SwapUint64(&t.dropped, 0); n > 0 {
+		t.logger().Warnf("dropped %d spans: export queue is full", n)
+	}
+}
+
+//shutdown: 导出剩余的span并关闭导出器，超时时中止导出，导出结束后才关闭导出器
+func (t *tracer) shutdown(ctx context.Context) {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+		select {
+		case <-t.done:
+		case <-ctx.Done():
+			t.cancel()
+			<-t.done
+		}
+		t.cancel()
+		if err := t.cfg.Exporter.Shutdown(ctx); err != nil {
+			t.logger().Error(err)
+		}
+	})
+}
+
+//logger: 记录导出错误的日志记录器，引擎未设置Logger时输出到os.Stderr
+func (t *tracer) logger() ILogger {
+	if t.cfg.Engine.Logger != nil {
+		return t.cfg.Engine.Logger
+	}
+	return NewLogger(nil)
+}
+
+//startClientSpan: 为出站请求创建parent的子客户端span，并将其写入请求的traceparent、tracestate
+//parent 当前span，为nil时不做处理
+//req 出站请求
+//return 客户端span，须调用endClientSpan结束
+func startClientSpan(parent *Span, req *http.Request) *Span {
+	if parent == nil {
+		return nil
+	}
+	sc := parent.SpanContext()
+	parentID := sc.SpanID
+	sc.SpanID = newSpanID()
+
+	span := parent.tracer.start(req.Method, SpanKindClient, sc, parentID)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.Redacted())
+	span.SetAttribute("server.address", req.URL.Hostname())
+
+	req.Header.Set(HeaderTraceparent, sc.Traceparent())
+	if sc.TraceState != "" {
+		req.Header.Set(HeaderTracestate, sc.TraceState)
+	} else {
+		req.Header.Del(HeaderTracestate)
+	}
+	return span
+}
+
+//endClientSpan: 记录出站请求的状态码或错误并结束客户端span，状态码大于等于400时为StatusError
+func (s *Span) endClientSpan(status int, err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.RecordError(err)
+	} else {
+		s.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusBadRequest {
+			s.SetStatus(StatusError, http.StatusText(status))
+		}
+	}
+	s.End()
+}
+
+//parseTraceState: 合并tracestate请求头，超出长度或成员数限制时丢弃
+func parseTraceState(values []string) string {
+	var members []string
+	for _, v := range values {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				if !strings.Contains(m, "=") {
+					return ""
+				}
+				members = append(members, m)
+			}
+		}
+	}
+	if len(members) > maxTraceStateMembers {
+		return ""
+	}
+	s := strings.Join(members, ",")
+	if len(s) > maxTraceStateLength {
+		return ""
+	}
+	return s
+}
+
+//isLowerHex: 是否全部为小写十六进制字符
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() (id TraceID) {
+	rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id SpanID) {
+	rand.Read(id[:])
+	return
+}
@@ -0,0 +1,727 @@
+package yun
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket消息类型
+const (
+	ContinuationMessage = 0
+	TextMessage         = 1
+	BinaryMessage       = 2
+	CloseMessage        = 8
+	PingMessage         = 9
+	PongMessage         = 10
+)
+
+// WebSocket关闭状态码
+const (
+	CloseNormalClosure     = 1000
+	CloseGoingAway         = 1001
+	CloseProtocolError     = 1002
+	CloseUnsupportedData   = 1003
+	CloseNoStatusReceived  = 1005
+	CloseAbnormalClosure   = 1006
+	CloseInvalidPayload    = 1007
+	ClosePolicyViolation   = 1008
+	CloseMessageTooBig     = 1009
+	CloseInternalServerErr = 1011
+)
+
+const (
+	//webSocketGUID 计算Sec-WebSocket-Accept的固定GUID
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	//DefaultWebSocketReadLimit 默认的单条消息最大读取字节数
+	DefaultWebSocketReadLimit = 4 << 20
+
+	maxControlPayload = 125
+	closeTimeout      = 5 * time.Second
+)
+
+var (
+	//ErrReadLimit 消息超过读取限制
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+	//ErrWriteLimit 消息超过写入限制
+	ErrWriteLimit = errors.New("websocket: write limit exceeded")
+	//ErrCloseSent 连接已发送关闭帧
+	ErrCloseSent = errors.New("websocket: close sent")
+
+	errBadHandshake = errors.New("websocket: bad handshake")
+
+	//deflateTail 压缩消息被去除的尾部，解压时补回
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+	flateWriterPool sync.Pool
+)
+
+type (
+	//Upgrader WebSocket升级配置
+	Upgrader struct {
+		//CheckOrigin 校验请求来源，为nil时要求Origin与Host一致
+		CheckOrigin func(*Context) bool
+		//Subprotocols 服务端支持的子协议，按优先级排列
+		Subprotocols []string
+		//EnableCompression 是否协商permessage-deflate压缩
+		EnableCompression bool
+		//ReadLimit 单条消息最大读取字节数，为0时使用DefaultWebSocketReadLimit
+		ReadLimit int64
+		//WriteLimit 单条消息最大写入字节数，为0时不限制
+		WriteLimit int64
+		//FragmentSize 发送消息的分片大小，为0时不分片
+		FragmentSize int
+		//PingInterval 心跳间隔，为0时不发送ping
+		PingInterval time.Duration
+		//PongWait 等待对端响应的最长时间，为0时取PingInterval的两倍
+		PongWait time.Duration
+	}
+
+	//Conn WebSocket连接，读操作只允许在一个goroutine中进行，写操作并发安全
+	Conn struct {
+		conn net.Conn
+		br   *bufio.Reader
+		bw   *bufio.Writer
+		ctx  *Context
+
+		subprotocol  string
+		compress     bool
+		readLimit    int64
+		writeLimit   int64
+		fragmentSize int
+		pongWait     time.Duration
+
+		writeLock  sync.Mutex
+		closeSent  bool
+		closeOnce  sync.Once
+		done       chan struct{}
+		readClosed bool
+	}
+
+	//CloseError 对端发送的关闭帧
+	CloseError struct {
+		Code int
+		Text string
+	}
+)
+
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+//WebSocket 注册WebSocket路由，升级请求经过路由组的全部中间件
+//handler 连接处理函数，返回后连接将被关闭
+//return 路由接口
+func (r *route) WebSocket(handler func(*Conn)) IRoute {
+	r.handle(GET, Handlers{func(c *Context) {
+		ws, err := c.Upgrade(c.engine.Upgrader)
+		if err != nil {
+			c.engine.printError(err)
+			return
+		}
+		defer ws.Close()
+
+		handler(ws)
+	}})
+	return r
+}
+
+//Upgrade 将请求升级为WebSocket连接，失败时已写入错误响应
+//u 升级配置，为nil时使用默认配置
+//return 返回连接、错误
+func (c *Context) Upgrade(u *Upgrader) (*Conn, error) {
+	if u == nil {
+		u = &Upgrader{}
+	}
+
+	req := c.Request()
+	if req.Method != GET ||
+		!headerContainsToken(req.Header, HeaderConnection, "upgrade") ||
+		!headerContainsToken(req.Header, HeaderUpgrade, "websocket") {
+		c.String(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return nil, errBadHandshake
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.Response().Header().Set("Sec-WebSocket-Version", "13")
+		c.String(http.StatusUpgradeRequired, http.StatusText(http.StatusUpgradeRequired))
+		return nil, errBadHandshake
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		c.String(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return nil, errBadHandshake
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(c) {
+		c.String(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return nil, errors.New("websocket: origin not allowed")
+	}
+
+	ws := &Conn{
+		ctx:          c,
+		subprotocol:  selectSubprotocol(req, u.Subprotocols),
+		compress:     u.EnableCompression && acceptDeflate(req),
+		readLimit:    u.ReadLimit,
+		writeLimit:   u.WriteLimit,
+		fragmentSize: u.FragmentSize,
+		done:         make(chan struct{}),
+	}
+	if ws.readLimit <= 0 {
+		ws.readLimit = DefaultWebSocketReadLimit
+	}
+
+	netConn, brw, err := c.ResponseWriter.Hijack()
+	if err != nil {
+		c.String(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return nil, err
+	}
+	ws.conn = netConn
+	ws.br = brw.Reader
+	ws.bw = brw.Writer
+
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	b.WriteString(acceptKey(key))
+	b.WriteString("\r\n")
+	if ws.subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + ws.subprotocol + "\r\n")
+	}
+	if ws.compress {
+		b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	c.Response().Header().Write(&b)
+	b.WriteString("\r\n")
+
+	netConn.SetDeadline(time.Time{})
+	if _, err = ws.bw.Write(b.Bytes()); err == nil {
+		err = ws.bw.Flush()
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	if u.PingInterval > 0 {
+		ws.pongWait = u.PongWait
+		if ws.pongWait <= 0 {
+			ws.pongWait = 2 * u.PingInterval
+		}
+		netConn.SetReadDeadline(time.Now().Add(ws.pongWait))
+		go ws.keepalive(u.PingInterval)
+	}
+
+	return ws, nil
+}
+
+//Context 获取升级请求的上下文，仅在处理函数返回前有效
+func (ws *Conn) Context() *Context {
+	return ws.ctx
+}
+
+//Subprotocol 获取协商的子协议
+func (ws *Conn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+//RemoteAddr 获取对端地址
+func (ws *Conn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+//SetReadLimit 设置单条消息最大读取字节数
+func (ws *Conn) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+//ReadMessage 读取一条完整消息，自动应答ping与关闭帧
+//return 返回消息类型、消息内容、错误，对端关闭时错误为*CloseError
+func (ws *Conn) ReadMessage() (int, []byte, error) {
+	if ws.readClosed {
+		return 0, nil, ErrCloseSent
+	}
+
+	var (
+		msgType    int
+		compressed bool
+		msg        []byte
+	)
+
+	for {
+		fin, op, rsv1, payload, err := ws.readFrame(int64(len(msg)))
+		if err != nil {
+			return 0, nil, ws.readFailed(err)
+		}
+
+		if ws.pongWait > 0 {
+			ws.conn.SetReadDeadline(time.Now().Add(ws.pongWait))
+		}
+
+		switch op {
+		case PingMessage:
+			if err = ws.writeControl(PongMessage, payload); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, ws.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "unexpected data frame")
+			}
+			msgType, compressed = op, rsv1
+		case ContinuationMessage:
+			if msgType == 0 || rsv1 {
+				return 0, nil, ws.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		}
+
+		msg = append(msg, payload...)
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			if msg, err = ws.inflate(msg); err != nil {
+				return 0, nil, err
+			}
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, ws.fail(CloseInvalidPayload, "invalid utf-8")
+		}
+		return msgType, msg, nil
+	}
+}
+
+//ReadJSON 读取一条消息并解析为JSON
+//v 解析结果
+//return 返回错误
+func (ws *Conn) ReadJSON(v interface{}) error {
+	_, b, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+//WriteMessage 发送一条消息
+//msgType 消息类型，TextMessage或BinaryMessage
+//data 消息内容
+//return 返回错误
+func (ws *Conn) WriteMessage(msgType int, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return ws.writeControl(msgType, data)
+	}
+	if ws.writeLimit > 0 && int64(len(data)) > ws.writeLimit {
+		return ErrWriteLimit
+	}
+
+	rsv1 := false
+	if ws.compress {
+		b, err := deflate(data)
+		if err != nil {
+			return err
+		}
+		data, rsv1 = b, true
+	}
+
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+
+	op := msgType
+	for {
+		n := len(data)
+		if ws.fragmentSize > 0 && n > ws.fragmentSize {
+			n = ws.fragmentSize
+		}
+		fin := n == len(data)
+		if err := ws.writeFrame(fin, op, rsv1, data[:n]); err != nil {
+			return err
+		}
+		if fin {
+			return ws.bw.Flush()
+		}
+		data, op, rsv1 = data[n:], ContinuationMessage, false
+	}
+}
+
+//WriteJSON 将对象编码为JSON并以文本消息发送
+//v 将要编码的对象
+//return 返回错误
+func (ws *Conn) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, b)
+}
+
+//Ping 发送ping帧
+//data 附带数据，最长125字节
+//return 返回错误
+func (ws *Conn) Ping(data []byte) error {
+	return ws.writeControl(PingMessage, data)
+}
+
+//CloseWithCode 发起关闭握手，对端的关闭帧由ReadMessage接收
+//code 关闭状态码
+//reason 关闭原因
+//return 返回错误
+func (ws *Conn) CloseWithCode(code int, reason string) error {
+	err := ws.writeControl(CloseMessage, closePayload(code, reason))
+	ws.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	return err
+}
+
+//Close 关闭连接，未发送关闭帧时先发送正常关闭
+//return 返回错误
+func (ws *Conn) Close() error {
+	var err error
+	ws.closeOnce.Do(func() {
+		close(ws.done)
+		ws.writeControl(CloseMessage, closePayload(CloseNormalClosure, ""))
+		err = ws.conn.Close()
+	})
+	return err
+}
+
+//keepalive: 定时发送ping帧
+func (ws *Conn) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-ticker.C:
+			if err := ws.writeControl(PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//readFrame: 读取一帧
+//read 当前消息已读取的字节数
+func (ws *Conn) readFrame(read int64) (fin bool, op int, rsv1 bool, payload []byte, err error) {
+	var h [8]byte
+	if _, err = io.ReadFull(ws.br, h[:2]); err != nil {
+		return
+	}
+
+	fin = h[0]&0x80 != 0
+	rsv1 = h[0]&0x40 != 0
+	op = int(h[0] & 0x0f)
+	masked := h[1]&0x80 != 0
+	length := int64(h[1] & 0x7f)
+
+	switch {
+	case h[0]&0x30 != 0, rsv1 && (!ws.compress || op >= CloseMessage):
+		err = ws.fail(CloseProtocolError, "unexpected reserved bits")
+		return
+	case op > BinaryMessage && op < CloseMessage, op > PongMessage:
+		err = ws.fail(CloseProtocolError, "unknown opcode")
+		return
+	case !masked:
+		err = ws.fail(CloseProtocolError, "client frame must be masked")
+		return
+	case op >= CloseMessage && (!fin || length > maxControlPayload):
+		err = ws.fail(CloseProtocolError, "invalid control frame")
+		return
+	}
+
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(ws.br, h[:2]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(h[:2]))
+	case 127:
+		if _, err = io.ReadFull(ws.br, h[:8]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(h[:8]))
+		if length < 0 {
+			err = ws.fail(CloseProtocolError, "invalid frame length")
+			return
+		}
+	}
+
+	if op < CloseMessage && read+length > ws.readLimit {
+		err = ws.fail(CloseMessageTooBig, "message too big")
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.br, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+	return
+}
+
+//writeFrame: 写入一帧，调用方须持有写锁
+func (ws *Conn) writeFrame(fin bool, op int, rsv1 bool, payload []byte) error {
+	var h [10]byte
+	h[0] = byte(op)
+	if fin {
+		h[0] |= 0x80
+	}
+	if rsv1 {
+		h[0] |= 0x40
+	}
+
+	n := 2
+	switch l := len(payload); {
+	case l <= maxControlPayload:
+		h[1] = byte(l)
+	case l <= 0xffff:
+		h[1] = 126
+		binary.BigEndian.PutUint16(h[2:], uint16(l))
+		n = 4
+	default:
+		h[1] = 127
+		binary.BigEndian.PutUint64(h[2:], uint64(l))
+		n = 10
+	}
+
+	if _, err := ws.bw.Write(h[:n]); err != nil {
+		return err
+	}
+	_, err := ws.bw.Write(payload)
+	return err
+}
+
+//writeControl: 发送控制帧
+func (ws *Conn) writeControl(op int, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return errors.New("websocket: control frame too long")
+	}
+
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	if op == CloseMessage {
+		ws.closeSent = true
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	defer ws.conn.SetWriteDeadline(time.Time{})
+
+	if err := ws.writeFrame(true, op, false, payload); err != nil {
+		return err
+	}
+	return ws.bw.Flush()
+}
+
+//handleClose: 处理对端的关闭帧
+func (ws *Conn) handleClose(payload []byte) error {
+	ws.readClosed = true
+
+	ce := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return ws.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Text = string(payload[2:])
+		if !validCloseCode(ce.Code) || !utf8.Valid(payload[2:]) {
+			return ws.fail(CloseProtocolError, "invalid close payload")
+		}
+	}
+
+	code := ce.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	ws.writeControl(CloseMessage, closePayload(code, ""))
+	return ce
+}
+
+//fail: 以指定状态码关闭连接并返回错误
+func (ws *Conn) fail(code int, reason string) error {
+	ws.readClosed = true
+	ws.writeControl(CloseMessage, closePayload(code, reason))
+	if code == CloseMessageTooBig {
+		return ErrReadLimit
+	}
+	return &CloseError{Code: code, Text: reason}
+}
+
+//readFailed: 读取出错时标记连接不可再读
+func (ws *Conn) readFailed(err error) error {
+	ws.readClosed = true
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	return err
+}
+
+//inflate: 解压消息，解压后的大小同样受读取限制
+func (ws *Conn) inflate(msg []byte) ([]byte, error) {
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(msg), bytes.NewReader(deflateTail)))
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, ws.readLimit+1))
+	if err != nil {
+		return nil, ws.fail(CloseInvalidPayload, "invalid compressed data")
+	}
+	if int64(len(b)) > ws.readLimit {
+		return nil, ws.fail(CloseMessageTooBig, "message too big")
+	}
+	return b, nil
+}
+
+//deflate: 压缩消息并去除同步刷新产生的尾部
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fw, _ := flateWriterPool.Get().(*flate.Writer)
+	if fw == nil {
+		fw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	} else {
+		fw.Reset(&buf)
+	}
+	defer flateWriterPool.Put(fw)
+
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail[:4]), nil
+}
+
+func closePayload(code int, reason string) []byte {
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	b := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	copy(b[2:], reason)
+	return b
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < 1000 || code > 1011:
+		return false
+	}
+	return code != 1004 && code != CloseNoStatusReceived && code != CloseAbnormalClosure
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//sameOrigin: 默认的来源校验，Origin的主机须与请求Host一致
+func sameOrigin(c *Context) bool {
+	origin := c.Request().Header.Get(HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+
+	i := strings.Index(origin, "://")
+	return i >= 0 && strings.EqualFold(origin[i+3:], c.Request().Host)
+}
+
+//selectSubprotocol: 按服务端优先级选择客户端支持的子协议
+func selectSubprotocol(req *http.Request, supported []string) string {
+	offered := headerTokens(req.Header, "Sec-WebSocket-Protocol")
+	for _, s := range supported {
+		for _, o := range offered {
+			if s == o {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+//acceptDeflate: 客户端是否提供可接受的permessage-deflate参数
+func acceptDeflate(req *http.Request) bool {
+	for _, ext := range headerTokens(req.Header, "Sec-WebSocket-Extensions") {
+		params := strings.Split(ext, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+
+		ok := true
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			//flate固定使用32K窗口，无法满足更小的服务端窗口
+			if strings.HasPrefix(p, "server_max_window_bits") && p != "server_max_window_bits" && p != "server_max_window_bits=15" {
+				ok = false
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+//headerTokens: 获取以逗号分隔的请求头取值
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+//headerContainsToken: 请求头是否包含指定标记，忽略大小写
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, t := range headerTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,410 @@
+package yun
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//testFrame 测试客户端收发的一帧
+type testFrame struct {
+	fin     bool
+	op      int
+	rsv1    bool
+	payload []byte
+}
+
+//newTestConn: 创建经由本地TCP连接的服务端Conn与客户端连接
+func newTestConn(t *testing.T) (*Conn, net.Conn, *bufio.Reader) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	ws := &Conn{
+		conn:      server,
+		br:        bufio.NewReader(server),
+		bw:        bufio.NewWriter(server),
+		readLimit: DefaultWebSocketReadLimit,
+		done:      make(chan struct{}),
+	}
+	return ws, client, bufio.NewReader(client)
+}
+
+//writeTestFrame: 以客户端身份写入一帧，masked为false时不加掩码
+func writeTestFrame(t *testing.T, w io.Writer, f testFrame, masked bool) {
+	t.Helper()
+	var b bytes.Buffer
+	h0 := byte(f.op)
+	if f.fin {
+		h0 |= 0x80
+	}
+	if f.rsv1 {
+		h0 |= 0x40
+	}
+	b.WriteByte(h0)
+
+	var h1 byte
+	if masked {
+		h1 = 0x80
+	}
+	switch l := len(f.payload); {
+	case l <= 125:
+		b.WriteByte(h1 | byte(l))
+	case l <= 0xffff:
+		b.WriteByte(h1 | 126)
+		binary.Write(&b, binary.BigEndian, uint16(l))
+	default:
+		b.WriteByte(h1 | 127)
+		binary.Write(&b, binary.BigEndian, uint64(l))
+	}
+
+	payload := append([]byte(nil), f.payload...)
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		b.Write(mask)
+		for i := range payload {
+			payload[i] ^= mask[i&3]
+		}
+	}
+	b.Write(payload)
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//readTestFrame: 以客户端身份读取服务端发送的一帧
+func readTestFrame(t *testing.T, r *bufio.Reader) testFrame {
+	t.Helper()
+	var h [8]byte
+	if _, err := io.ReadFull(r, h[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if h[1]&0x80 != 0 {
+		t.Fatal("server frame must not be masked")
+	}
+
+	f := testFrame{fin: h[0]&0x80 != 0, op: int(h[0] & 0x0f), rsv1: h[0]&0x40 != 0}
+	length := uint64(h[1] & 0x7f)
+	switch length {
+	case 126:
+		io.ReadFull(r, h[:2])
+		length = uint64(binary.BigEndian.Uint16(h[:2]))
+	case 127:
+		io.ReadFull(r, h[:8])
+		length = binary.BigEndian.Uint64(h[:8])
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+//readTestClose: 读取关闭帧并返回其状态码
+func readTestClose(t *testing.T, r *bufio.Reader) int {
+	t.Helper()
+	f := readTestFrame(t, r)
+	if f.op != CloseMessage || len(f.payload) < 2 {
+		t.Fatalf("expected a close frame, got op %d payload %q", f.op, f.payload)
+	}
+	return int(binary.BigEndian.Uint16(f.payload))
+}
+
+//readMessageAsync: 在后台读取一条消息
+func readMessageAsync(ws *Conn) <-chan testFrame {
+	ch := make(chan testFrame, 1)
+	go func() {
+		op, msg, err := ws.ReadMessage()
+		f := testFrame{op: op, payload: msg}
+		if err != nil {
+			f.payload = []byte(err.Error())
+			f.op = -1
+			var ce *CloseError
+			if errors.As(err, &ce) {
+				f.op = -ce.Code
+			}
+			if err == ErrReadLimit {
+				f.op = -CloseMessageTooBig
+			}
+		}
+		ch <- f
+	}()
+	return ch
+}
+
+//TestWebSocketHandshake 握手成功后收发消息，版本不符时返回426
+func TestWebSocketHandshake(t *testing.T) {
+	eng := New(RELEASE)
+	eng.Handle("/ws").WebSocket(func(ws *Conn) {
+		op, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		ws.WriteMessage(op, msg)
+		ws.ReadMessage()
+	})
+	srv := httptest.NewServer(eng)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(GET, srv.URL+"/ws", nil)
+	req.Header.Set(HeaderConnection, "Upgrade")
+	req.Header.Set(HeaderUpgrade, "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "12")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426 for an unsupported version, got %d", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err = req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected Sec-WebSocket-Accept %q", got)
+	}
+
+	writeTestFrame(t, conn, testFrame{fin: true, op: TextMessage, payload: []byte("hello")}, true)
+	if f := readTestFrame(t, br); f.op != TextMessage || string(f.payload) != "hello" {
+		t.Fatalf("unexpected echo: op %d payload %q", f.op, f.payload)
+	}
+
+	writeTestFrame(t, conn, testFrame{fin: true, op: CloseMessage, payload: closePayload(CloseNormalClosure, "")}, true)
+	if code := readTestClose(t, br); code != CloseNormalClosure {
+		t.Fatalf("expected close code %d, got %d", CloseNormalClosure, code)
+	}
+}
+
+//TestWebSocketMasking 解除客户端掩码，拒绝未加掩码的帧
+func TestWebSocketMasking(t *testing.T) {
+	ws, client, br := newTestConn(t)
+
+	payload := bytes.Repeat([]byte("masked payload "), 20)
+	ch := readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: BinaryMessage, payload: payload}, true)
+	if f := <-ch; f.op != BinaryMessage || !bytes.Equal(f.payload, payload) {
+		t.Fatalf("unexpected message: op %d len %d", f.op, len(f.payload))
+	}
+
+	ch = readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: TextMessage, payload: []byte("plain")}, false)
+	if f := <-ch; f.op != -CloseProtocolError {
+		t.Fatalf("expected a protocol error, got op %d %q", f.op, f.payload)
+	}
+	if code := readTestClose(t, br); code != CloseProtocolError {
+		t.Fatalf("expected close code %d, got %d", CloseProtocolError, code)
+	}
+}
+
+//TestWebSocketFragmentation 合并分片消息，分片之间可插入控制帧，发送时按FragmentSize分片
+func TestWebSocketFragmentation(t *testing.T) {
+	ws, client, br := newTestConn(t)
+
+	ch := readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{op: TextMessage, payload: []byte("Hel")}, true)
+	writeTestFrame(t, client, testFrame{fin: true, op: PingMessage, payload: []byte("p")}, true)
+	writeTestFrame(t, client, testFrame{op: ContinuationMessage, payload: []byte("lo, ")}, true)
+	writeTestFrame(t, client, testFrame{fin: true, op: ContinuationMessage, payload: []byte("world")}, true)
+	if f := readTestFrame(t, br); f.op != PongMessage || string(f.payload) != "p" {
+		t.Fatalf("expected pong, got op %d payload %q", f.op, f.payload)
+	}
+	if f := <-ch; f.op != TextMessage || string(f.payload) != "Hello, world" {
+		t.Fatalf("unexpected message: op %d payload %q", f.op, f.payload)
+	}
+
+	ws.fragmentSize = 4
+	if err := ws.WriteMessage(BinaryMessage, []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	var frames []testFrame
+	for {
+		f := readTestFrame(t, br)
+		frames = append(frames, f)
+		if f.fin {
+			break
+		}
+	}
+	if len(frames) != 3 || frames[0].op != BinaryMessage || frames[1].op != ContinuationMessage || frames[2].op != ContinuationMessage {
+		t.Fatalf("unexpected fragments: %+v", frames)
+	}
+	if got := string(frames[0].payload) + string(frames[1].payload) + string(frames[2].payload); got != "0123456789" {
+		t.Fatalf("unexpected reassembled message %q", got)
+	}
+
+	ch = readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: ContinuationMessage, payload: []byte("x")}, true)
+	if f := <-ch; f.op != -CloseProtocolError {
+		t.Fatalf("expected a protocol error for a lone continuation, got op %d", f.op)
+	}
+}
+
+//TestWebSocketControlFrames 控制帧不得分片，长度不得超过125字节
+func TestWebSocketControlFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame testFrame
+	}{
+		{"fragmented ping", testFrame{op: PingMessage, payload: []byte("p")}},
+		{"oversized ping", testFrame{fin: true, op: PingMessage, payload: bytes.Repeat([]byte("p"), 126)}},
+		{"compressed ping", testFrame{fin: true, op: PingMessage, rsv1: true}},
+		{"unknown opcode", testFrame{fin: true, op: 3}},
+		{"one byte close", testFrame{fin: true, op: CloseMessage, payload: []byte{1}}},
+		{"invalid close code", testFrame{fin: true, op: CloseMessage, payload: closePayload(1005, "")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, client, br := newTestConn(t)
+			ch := readMessageAsync(ws)
+			writeTestFrame(t, client, tt.frame, true)
+			if f := <-ch; f.op != -CloseProtocolError {
+				t.Fatalf("expected a protocol error, got op %d %q", f.op, f.payload)
+			}
+			if code := readTestClose(t, br); code != CloseProtocolError {
+				t.Fatalf("expected close code %d, got %d", CloseProtocolError, code)
+			}
+		})
+	}
+}
+
+//TestWebSocketCloseHandshake 应答对端的关闭帧，关闭后不能再发送消息
+func TestWebSocketCloseHandshake(t *testing.T) {
+	ws, client, br := newTestConn(t)
+
+	ch := readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: CloseMessage, payload: closePayload(CloseGoingAway, "bye")}, true)
+	if f := <-ch; f.op != -CloseGoingAway || !strings.HasSuffix(string(f.payload), "bye") {
+		t.Fatalf("unexpected close error: op %d %q", f.op, f.payload)
+	}
+	if code := readTestClose(t, br); code != CloseGoingAway {
+		t.Fatalf("expected close code %d, got %d", CloseGoingAway, code)
+	}
+	if err := ws.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+		t.Fatalf("expected ErrCloseSent, got %v", err)
+	}
+	if _, _, err := ws.ReadMessage(); err != ErrCloseSent {
+		t.Fatalf("expected ErrCloseSent, got %v", err)
+	}
+
+	ws, client, br = newTestConn(t)
+	if err := ws.CloseWithCode(CloseNormalClosure, "done"); err != nil {
+		t.Fatal(err)
+	}
+	if code := readTestClose(t, br); code != CloseNormalClosure {
+		t.Fatalf("expected close code %d, got %d", CloseNormalClosure, code)
+	}
+	ch = readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: CloseMessage, payload: closePayload(CloseNormalClosure, "")}, true)
+	if f := <-ch; f.op != -CloseNormalClosure {
+		t.Fatalf("expected the peer close, got op %d %q", f.op, f.payload)
+	}
+}
+
+//TestWebSocketReadLimit 单帧或分片合计超过读取限制时以1009关闭
+func TestWebSocketReadLimit(t *testing.T) {
+	ws, client, br := newTestConn(t)
+	ws.SetReadLimit(8)
+
+	ch := readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: BinaryMessage, payload: make([]byte, 9)}, true)
+	if f := <-ch; f.op != -CloseMessageTooBig {
+		t.Fatalf("expected ErrReadLimit, got op %d %q", f.op, f.payload)
+	}
+	if code := readTestClose(t, br); code != CloseMessageTooBig {
+		t.Fatalf("expected close code %d, got %d", CloseMessageTooBig, code)
+	}
+
+	ws, client, br = newTestConn(t)
+	ws.SetReadLimit(8)
+	ch = readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{op: BinaryMessage, payload: make([]byte, 5)}, true)
+	writeTestFrame(t, client, testFrame{fin: true, op: ContinuationMessage, payload: make([]byte, 5)}, true)
+	if f := <-ch; f.op != -CloseMessageTooBig {
+		t.Fatalf("expected ErrReadLimit for fragments, got op %d %q", f.op, f.payload)
+	}
+	if code := readTestClose(t, br); code != CloseMessageTooBig {
+		t.Fatalf("expected close code %d, got %d", CloseMessageTooBig, code)
+	}
+
+	ws, _, _ = newTestConn(t)
+	ws.writeLimit = 4
+	if err := ws.WriteMessage(TextMessage, []byte("too long")); err != ErrWriteLimit {
+		t.Fatalf("expected ErrWriteLimit, got %v", err)
+	}
+}
+
+//TestWebSocketCompression permessage-deflate消息的收发
+func TestWebSocketCompression(t *testing.T) {
+	ws, client, br := newTestConn(t)
+	ws.compress = true
+
+	msg := bytes.Repeat([]byte("compressible "), 50)
+	data, err := deflate(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := readMessageAsync(ws)
+	writeTestFrame(t, client, testFrame{fin: true, op: TextMessage, rsv1: true, payload: data}, true)
+	if f := <-ch; f.op != TextMessage || !bytes.Equal(f.payload, msg) {
+		t.Fatalf("unexpected inflated message: op %d %q", f.op, f.payload)
+	}
+
+	if err = ws.WriteMessage(TextMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	f := readTestFrame(t, br)
+	if !f.rsv1 || len(f.payload) >= len(msg) {
+		t.Fatalf("expected a compressed frame, rsv1 %v len %d", f.rsv1, len(f.payload))
+	}
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(f.payload), bytes.NewReader(deflateTail)))
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("unexpected deflated payload: %v", err)
+	}
+}
@@ -1,21 +1,75 @@
 package yun
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type (
 	//Engine 框架引擎
 	Engine struct {
+		//Upgrader WebSocket路由使用的升级配置，为nil时使用默认配置
+		Upgrader *Upgrader
+		//Client Context.Send使用的出站http客户端
+		Client *Client
+		//Logger Context.Logger使用的日志记录器
+		Logger ILogger
+
+		//ReadTimeout 读取整个请求的超时时间
+		ReadTimeout time.Duration
+		//ReadHeaderTimeout 读取请求头的超时时间
+		ReadHeaderTimeout time.Duration
+		//WriteTimeout 写响应的超时时间
+		WriteTimeout time.Duration
+		//IdleTimeout 长连接的空闲超时时间
+		IdleTimeout time.Duration
+		//MaxHeaderBytes 请求头的最大字节数
+		MaxHeaderBytes int
+		//MaxBodySize 请求体的最大字节数，为0时不限制，路由可通过BodyLimit覆盖
+		MaxBodySize int64
+		//ShutdownTimeout 优雅关闭的超时时间，为0时使用DefaultShutdownTimeout
+		ShutdownTimeout time.Duration
+		//ShutdownDelay 收到关闭信号后继续服务的时间，便于负载均衡摘除本实例
+		ShutdownDelay time.Duration
+
+		//TrustedProxies 可信代理的地址段，仅信任来自这些地址的转发头（ClientIP、X-Forwarded-Proto）与PROXY协议头
+		TrustedProxies []netip.Prefix
+		//ProxyProtocol 是否在监听器上解析PROXY协议头（v1/v2），只解析来自TrustedProxies的协议头
+		ProxyProtocol bool
+		//ProxyProtocolRequired 是否拒绝不是来自TrustedProxies或未携带PROXY协议头的连接
+		ProxyProtocolRequired bool
+
+		//ClientCAs RunTLS验证客户端证书使用的根证书
+		ClientCAs *x509.CertPool
+		//ClientAuth RunTLS的客户端证书验证策略
+		ClientAuth tls.ClientAuthType
+
 		middlewares []HandlerFunc
 		pool        sync.Pool
 		router      router
 		mode        Mode
+		funcMap     template.FuncMap
+		htmlRender  *htmlRender
+
+		serverLock   sync.Mutex
+		servers      []*http.Server
+		onStart      []func() error
+		startLock    sync.Mutex
+		running      int
+		onShutdown   []func(context.Context)
+		shuttingDown int32
 	}
 
 	//IGroup 路由组接口
@@ -35,10 +89,17 @@ func New(mode Mode) *Engine {
 	eng := &Engine{}
 
 	eng.mode = mode
+	eng.Client = NewClient()
+	eng.Logger = NewLogger(os.Stderr)
 	eng.pool.New = func() interface{} {
-		return &Context{}
+		return &Context{engine: eng}
+	}
+	eng.router = router{
+		minPrefix:   9999,
+		names:       make(map[string]string),
+		preflights:  make(map[string]bool),
+		groupLevels: make(map[staticRouteKey]int),
 	}
-	eng.router = router{minPrefix: 9999}
 
 	eng.printDebugInfo(`[WARNING] Running in "debug" mode. Switch to "release" mode in production.
  - using code:	yun.New(yun.RELEASE) or yun.SetMode(yun.RELEASE)
@@ -51,22 +112,35 @@ func (eng *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	c := eng.pool.Get().(*Context)
 	c.reset(w, req)
 
-	//eng.handleHTTPRequest(c)
-	hs := eng.findStaticRoute(req.URL.Path, req.Method)
-
-	var params Params
-	if hs == nil {
-		hs, params = eng.findDynamicRoute(req.URL.Path, req.Method)
+	var body *limitedBody
+	if eng.MaxBodySize > 0 && req.Body != nil && req.Body != http.NoBody {
+		body = &limitedBody{rc: req.Body, limit: eng.MaxBodySize}
+		req.Body = body
 	}
 
+	//eng.handleHTTPRequest(c)
+	hs, pattern, params := eng.findRoute(req.URL.Path, req.Method)
+
 	if hs != nil {
 		c.setHandlers(hs)
 		c.Params = params
+		c.fullPath = pattern
 		c.Next()
 	} else if req.Method == "OPTIONS" {
-		c.setHandlers(eng.middlewares)
+		//未注册OPTIONS时执行同一路径的预检执行链，仍未找到则只执行全局中间件
+		hs, pattern, params = eng.findRoute(req.URL.Path, preflightMethod)
+		if hs == nil {
+			hs = eng.middlewares
+		}
+
+		c.setHandlers(hs)
+		c.Params = params
+		c.fullPath = pattern
 		c.Next()
 	}
+	if body != nil {
+		body.respond(c)
+	}
 	/*	if !c.Written() {
 		p := req.URL.Path
 		if len(req.URL.RawQuery) > 0 {
@@ -82,14 +156,15 @@ func (eng *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	eng.pool.Put(c)
 }
 
-//Run 运行http服务
+//Run 运行http服务，收到SIGINT或SIGTERM时优雅关闭
 //addr 服务地址
 //return 返回错误
 func (eng *Engine) Run(addr ...string) error {
-	address := resolveAddress(addr)
-	eng.printDebugInfo("Listening and serving HTTP on %s\n", address)
-	err := http.ListenAndServe(address, eng)
-	return err
+	address, err := resolveAddress(addr)
+	if err != nil {
+		return err
+	}
+	return eng.RunWithContext(signalContext(), address)
 }
 
 //Handle 路由
@@ -161,29 +236,38 @@ func (eng *Engine) Up() IGroup {
 	return nil
 }
 
-func resolveAddress(addr []string) string {
+func resolveAddress(addr []string) (string, error) {
 	switch len(addr) {
 	case 0:
 		if port := os.Getenv("PORT"); len(port) > 0 {
 			//debugPrint("Environment variable PORT=\"%s\"", port)
-			return ":" + port
+			return checkAddress(":" + port)
 		}
 		//debugPrint("Environment variable PORT is undefined. Using port :8080 by default")
-		return ":8000"
+		return ":8000", nil
 	case 1:
-		{
-			_, err := strconv.ParseUint(addr[0][1:], 10, 32)
-			if err != nil {
-				err = fmt.Errorf("Port number format error: %s", err)
-				panic(err)
-			}
-			return addr[0]
-		}
+		return checkAddress(addr[0])
 	default:
-		panic("too much parameters")
+		return "", errors.New("too much parameters")
 	}
 }
 
+//checkAddress: 校验host:port格式的地址，仅有端口号时监听全部地址
+func checkAddress(addr string) (string, error) {
+	if _, err := strconv.ParseUint(addr, 10, 16); err == nil {
+		addr = ":" + addr
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("Address format error: %s", err)
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("Port number format error: %s", err)
+	}
+	return addr, nil
+}
+
 //findStaticRoute: 查找静态路由
 func (eng *Engine) findStaticRoute(path, meth string) Handlers {
 	key := staticRouteKey{
@@ -197,8 +281,19 @@ func (eng *Engine) findStaticRoute(path, meth string) Handlers {
 	return nil
 }
 
-//findDynamicRoute: 查找动态路由
-func (eng *Engine) findDynamicRoute(path, method string) (Handlers, Params) {
+//findRoute: 依次查找静态路由与动态路由，返回执行链、路由路径与参数
+func (eng *Engine) findRoute(path, method string) (Handlers, string, Params) {
+	if hs := eng.findStaticRoute(path, method); hs != nil {
+		return hs, path, nil
+	}
+	if ds, params := eng.findDynamicRoute(path, method); ds != nil {
+		return ds.handlers, ds.pattern, params
+	}
+	return nil, "", nil
+}
+
+//findDynamicRoute: 查找动态路由，级数相同的路由优先，其次按前缀由长到短匹配以适配节点结尾的路由
+func (eng *Engine) findDynamicRoute(path, method string) (*dynamicRoute, Params) {
 	pathLen := uint16(len(path))
 	levelNum := uint8(strings.Count(path, "/"))
 
@@ -208,46 +303,89 @@ func (eng *Engine) findDynamicRoute(path, method string) (Handlers, Params) {
 		}
 
 		key := dynamicRouteKey{prefix: path[:int(i)], levels: levelNum, method: method}
-		rs, has := eng.router.dynamicRoutes[key]
-		if !has {
+		if ds, params := eng.matchDynamicRoutes(path, key); ds != nil {
+			return ds, params
+		}
+	}
+
+	for i := int(eng.router.maxPrefix); i >= int(eng.router.minPrefix); i-- {
+		if i > int(pathLen) {
+			continue
+		}
+
+		key := dynamicRouteKey{prefix: path[:i], method: method}
+		if ds, params := eng.matchDynamicRoutes(path, key); ds != nil {
+			return ds, params
+		}
+	}
+	return nil, nil
+}
+
+//matchDynamicRoutes: 在同一前缀与级数的路由中查找匹配项
+func (eng *Engine) matchDynamicRoutes(path string, key dynamicRouteKey) (*dynamicRoute, Params) {
+	rs, has := eng.router.dynamicRoutes[key]
+	if !has {
+		return nil, nil
+	}
+
+	i := len(key.prefix)
+	//前缀之后必须是路径分隔符
+	if i >= len(path) || path[i] != '/' {
+		return nil, nil
+	}
+
+	for k := range rs {
+		if key.levels == 0 && strings.Count(path, "/") < int(rs[k].levels) {
 			continue
 		}
 
-		for k := range rs {
-			ppath := path[i+1:]
-			node := rs[k].path
-			params := make(Params, rs[k].paramNum)
-			n, nextStart, match := 0, 0, true
-		pathLoop:
-			for {
-				switch node.ntype {
-				case fIXED:
-					pplen := len(ppath)
-					if pplen < node.length || pplen >= node.length && ppath[:node.length] != node.path {
-						match = false
-						break pathLoop
-					}
-					nextStart = node.length
-				case pARAM, cATCHAll:
-					end := 0
-					for len := len(ppath); end < len && ppath[end] != '/'; end++ {
-					}
-					param := Param{Key: node.path, Value: ppath[:end]}
-					params[n] = param
+		ppath := path[i+1:]
+		node := rs[k].path
+		params := make(Params, rs[k].paramNum)
+		n, nextStart, match := 0, 0, true
+	pathLoop:
+		for {
+			switch node.ntype {
+			case fIXED:
+				pplen := len(ppath)
+				if pplen < node.length || ppath[:node.length] != node.path ||
+					node.next == nil && pplen != node.length {
+					match = false
+					break pathLoop
+				}
+				nextStart = node.length
+			case cATCHAll:
+				//路径末尾的适配节点匹配其余全部路径
+				if node.next == nil {
+					params[n] = Param{Key: node.path, Value: ppath}
 					n++
-					nextStart = end
+					nextStart = len(ppath)
+					break
+				}
+				fallthrough
+			case pARAM:
+				end := 0
+				for len := len(ppath); end < len && ppath[end] != '/'; end++ {
 				}
-				if node.next != nil {
-					ppath = ppath[nextStart+1:]
-					node = node.next
-				} else {
+				param := Param{Key: node.path, Value: ppath[:end]}
+				params[n] = param
+				n++
+				nextStart = end
+			}
+			if node.next != nil {
+				if nextStart >= len(ppath) {
+					match = false
 					break
 				}
+				ppath = ppath[nextStart+1:]
+				node = node.next
+			} else {
+				break
 			}
+		}
 
-			if match {
-				return rs[k].handlers, params
-			}
+		if match {
+			return rs[k], params
 		}
 	}
 	return nil, nil